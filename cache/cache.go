@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zabbix-source/cache/sqlite"
+	"zabbix-source/config"
+	"zabbix-source/db"
+	"zabbix-source/logger"
+)
+
+var (
+	defaultSyncInterval = 10 * time.Minute
+	defaultChunkSize    = 5000
+)
+
+// Service 定期将 Zabbix 数据库中的元数据同步到本地 sqlite 缓存
+// 每次同步后由 sqlite 重新构建内存索引并原子替换 查询时无需加锁
+// Zabbix 数据库不可用时使用 sqlite 中上一次同步的数据 下个周期重试
+// 上次同步之后新建的监控项按需查询 在下次重建索引前保存在覆盖索引中
+type Service struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conf    config.CacheConfig
+	sqlConf config.SQLConfig
+	sqlite  *sql.DB
+	dbMu    sync.Mutex
+	zdb     *db.DB
+	index   atomic.Pointer[Index]
+
+	overlayMu sync.Mutex
+	overlay   atomic.Pointer[Index]
+	// missed 等待查询或确认不存在的 itemid 值为可以再次查询的时间
+	missed sync.Map
+	misses chan uint64
+}
+
+func New(conf config.CacheConfig, sqlConf config.SQLConfig) (*Service, error) {
+	if conf.Path == "" {
+		return nil, fmt.Errorf("cache path is required")
+	}
+	if conf.SyncInterval <= 0 {
+		conf.SyncInterval = defaultSyncInterval
+	}
+	if conf.ChunkSize <= 0 {
+		conf.ChunkSize = defaultChunkSize
+	}
+	if conf.MissInterval <= 0 {
+		conf.MissInterval = defaultMissInterval
+	}
+	if conf.MissBatchSize <= 0 {
+		conf.MissBatchSize = defaultMissBatchSize
+	}
+	if conf.NegativeTTL <= 0 {
+		conf.NegativeTTL = defaultNegativeTTL
+	}
+	s, err := sqlite.Open(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	svc := &Service{
+		wg:      sync.WaitGroup{},
+		conf:    conf,
+		sqlConf: sqlConf,
+		sqlite:  s,
+		misses:  make(chan uint64, conf.MissBatchSize*missQueueBatches),
+	}
+	// 重启后直接使用 sqlite 中的数据 不必等待第一次同步
+	if last, err := sqlite.GetMeta(s, sqlite.MetaLastSync); err == nil && last != "" {
+		if err := svc.reload(); err != nil {
+			logger.Errorf("cache warm start failed: %v", err)
+		}
+	}
+	return svc, nil
+}
+
+// Index 返回当前的内存索引 第一次同步完成前可能为 nil
+func (s *Service) Index() *Index {
+	return s.index.Load()
+}
+
+// reload 从 sqlite 构建新的索引并替换当前索引
+func (s *Service) reload() error {
+	start := time.Now()
+	idx, err := LoadIndex(s.sqlite)
+	if err != nil {
+		return err
+	}
+	s.index.Store(idx)
+	// 覆盖索引中已经同步到 sqlite 的数据不再需要
+	s.overlayMu.Lock()
+	s.overlay.Store(s.overlay.Load().prune(idx))
+	s.overlayMu.Unlock()
+	stats := idx.Stats()
+	logger.Infof("cache index loaded in %s: %d items, %d hosts, about %d MiB", time.Since(start), stats.Items, stats.Hosts, stats.Bytes>>20)
+	if s.conf.MemoryLimit > 0 && stats.Bytes > s.conf.MemoryLimit {
+		logger.Warnf("cache index uses about %d bytes, exceeds memory_limit %d", stats.Bytes, s.conf.MemoryLimit)
+	}
+	return nil
+}
+
+func (s *Service) Start() {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(2)
+	go s.run()
+	go s.runResolver()
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.conf.SyncInterval)
+	defer ticker.Stop()
+	s.sync()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.sync()
+		}
+	}
+}
+
+// zabbixDB 第一次使用时连接 Zabbix 数据库 失败时下次调用重试
+func (s *Service) zabbixDB() (*db.DB, error) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	if s.zdb == nil {
+		zdb, err := db.Open(s.sqlConf)
+		if err != nil {
+			return nil, err
+		}
+		s.zdb = zdb
+	}
+	return s.zdb, nil
+}
+
+// sync 执行一次同步 失败时只记录日志
+func (s *Service) sync() {
+	zdb, err := s.zabbixDB()
+	if err != nil {
+		logger.Warnf("cache sync skipped, zabbix db unavailable: %v", err)
+		return
+	}
+	start := time.Now()
+	changes, err := sqlite.Sync(zdb, s.sqlite, s.conf.ChunkSize)
+	if err != nil {
+		logger.Errorf("cache sync failed: %v", err)
+		return
+	}
+	total := 0
+	for _, c := range changes {
+		total += c.Total()
+	}
+	logger.Infof("cache sync finished in %s with %d changes", time.Since(start), total)
+	if total == 0 && s.index.Load() != nil {
+		return
+	}
+	if err := s.reload(); err != nil {
+		logger.Errorf("cache index reload failed: %v", err)
+	}
+}
+
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	if s.zdb != nil {
+		s.zdb.Close()
+	}
+	s.sqlite.Close()
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"zabbix-source/record"
+)
+
+// Process 实现 pipeline.Stage 补充元数据后继续处理 不会丢弃记录
+// 索引中没有的 itemid 加入按需查询队列 之后的记录可以补充
+func (s *Service) Process(rec *record.Record) bool {
+	v := view{idx: s.index.Load(), overlay: s.overlay.Load()}
+	if v.idx == nil {
+		return true
+	}
+	if !enrich(v, rec) {
+		s.miss(rec.ItemID)
+	}
+	return true
+}
+
+// view 同时查找完整索引与按需查询得到的覆盖索引
+type view struct {
+	idx     *Index
+	overlay *Index
+}
+
+func (v view) item(itemID uint64) (*ItemMeta, bool) {
+	if m, ok := v.idx.Item(itemID); ok || v.overlay == nil {
+		return m, ok
+	}
+	return v.overlay.Item(itemID)
+}
+
+func (v view) host(hostID uint64) (*HostMeta, bool) {
+	if m, ok := v.idx.Host(hostID); ok || v.overlay == nil {
+		return m, ok
+	}
+	return v.overlay.Host(hostID)
+}
+
+func (v view) hostByName(host string) (*HostMeta, bool) {
+	if m, ok := v.idx.HostByName(host); ok || v.overlay == nil {
+		return m, ok
+	}
+	return v.overlay.HostByName(host)
+}
+
+// enrich 使用索引补充记录的监控项 key 单位 模板 主机 IP 主机组 标签与资产信息
+// 记录中已有的字段保持不变 切片与索引共享 不能修改
+// 返回记录中的 itemid 是否在索引中
+func enrich(v view, rec *record.Record) bool {
+	var (
+		host  *HostMeta
+		found = rec.ItemID == 0
+	)
+	if item, ok := v.item(rec.ItemID); ok {
+		found = true
+		if rec.ItemKey == "" {
+			rec.ItemKey = item.Key
+		}
+		if item.Template != "" {
+			setDimension(rec, "template", item.Template)
+		}
+		if len(rec.ItemTags) == 0 {
+			rec.ItemTags = item.Tags
+		}
+		if rec.Units == "" {
+			rec.Units = item.Units
+		}
+		host, _ = v.host(item.HostID)
+	}
+	// zabbix_sender 推送的记录以及问题事件只有主机名
+	if host == nil {
+		if name := rec.HostName(); name != "" {
+			host, _ = v.hostByName(name)
+		}
+	}
+	if host == nil {
+		return found
+	}
+	if rec.Host == nil && rec.Type != record.TypeEvents {
+		rec.Host = &record.Host{Host: host.Host, Name: host.Name}
+	}
+	if rec.IP == "" {
+		rec.IP = host.IP
+	}
+	if len(rec.Groups) == 0 {
+		rec.Groups = host.Groups
+	}
+	for _, t := range host.Tags {
+		setDimension(rec, "host_tag_"+t.Tag, t.Value)
+	}
+	for k, v := range host.Inventory {
+		setDimension(rec, "inventory_"+k, v)
+	}
+	return found
+}
+
+func setDimension(rec *record.Record, key, value string) {
+	if rec.Dimensions == nil {
+		rec.Dimensions = make(map[string]string)
+	}
+	if _, ok := rec.Dimensions[key]; !ok {
+		rec.Dimensions[key] = value
+	}
+}
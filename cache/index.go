@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"zabbix-source/cache/sqlite"
+	"zabbix-source/record"
+)
+
+// 内存占用估算时每个对象与 map 条目的固定开销
+const (
+	itemOverhead  = 96
+	hostOverhead  = 160
+	entryOverhead = 48
+)
+
+// inventoryFields 补充为维度的资产字段
+var inventoryFields = []string{"location", "location_lat", "location_lon", "site_city", "site_country", "site_rack", "asset_tag", "serialno_a", "os"}
+
+// ItemMeta 监控项元数据
+type ItemMeta struct {
+	ItemID uint64
+	HostID uint64
+	Key    string
+	// Template 监控项直接继承的模板名称 自动发现的监控项为空
+	Template string
+	Tags     []record.Tag
+	Units    string
+}
+
+// HostMeta 主机元数据
+type HostMeta struct {
+	HostID uint64
+	Host   string
+	Name   string
+	// IP 默认 agent 接口的地址 没有 agent 接口时使用其他类型的默认接口
+	IP        string
+	Groups    []string
+	Tags      []record.Tag
+	Inventory map[string]string
+}
+
+// Index sqlite 缓存的内存快照 构建完成后只读 可以并发访问
+type Index struct {
+	items       map[uint64]*ItemMeta
+	hosts       map[uint64]*HostMeta
+	hostsByName map[string]*HostMeta
+	// bytes 估算的内存占用
+	bytes int64
+}
+
+// Stats 索引的规模
+type Stats struct {
+	Items int
+	Hosts int
+	Bytes int64
+}
+
+func (i *Index) Item(itemID uint64) (*ItemMeta, bool) {
+	m, ok := i.items[itemID]
+	return m, ok
+}
+
+func (i *Index) Host(hostID uint64) (*HostMeta, bool) {
+	m, ok := i.hosts[hostID]
+	return m, ok
+}
+
+// HostByName 按主机的技术名称查找
+func (i *Index) HostByName(host string) (*HostMeta, bool) {
+	m, ok := i.hostsByName[host]
+	return m, ok
+}
+
+func (i *Index) Stats() Stats {
+	return Stats{Items: len(i.items), Hosts: len(i.hosts), Bytes: i.bytes}
+}
+
+func scanAll(s *sql.DB, table, queryStr string, scan func(rows *sql.Rows) error) error {
+	rows, err := s.Query(queryStr)
+	if err != nil {
+		return fmt.Errorf("load %s failed: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("scan %s failed: %w", table, err)
+		}
+	}
+	return rows.Err()
+}
+
+// builder 逐行构建索引 模板 监控项 主机需先于标签等关联数据加入
+type builder struct {
+	idx       *Index
+	templates map[uint64]string
+	// templateItems 模板上的监控项只用于查找继承关系 不放入索引
+	templateItems map[uint64]uint64
+	parents       map[uint64]uint64
+	// ipTypes 已选中的接口类型 agent 接口的类型为 1 优先使用
+	ipTypes map[uint64]int
+}
+
+func newBuilder() *builder {
+	return &builder{
+		idx: &Index{
+			items:       make(map[uint64]*ItemMeta),
+			hosts:       make(map[uint64]*HostMeta),
+			hostsByName: make(map[string]*HostMeta),
+		},
+		templates:     make(map[uint64]string),
+		templateItems: make(map[uint64]uint64),
+		parents:       make(map[uint64]uint64),
+		ipTypes:       make(map[uint64]int),
+	}
+}
+
+func (b *builder) addTemplate(hostID uint64, name string) {
+	b.templates[hostID] = name
+}
+
+func (b *builder) addItem(item ItemMeta, templateID sql.NullInt64) {
+	if _, ok := b.templates[item.HostID]; ok {
+		b.templateItems[item.ItemID] = item.HostID
+		return
+	}
+	if templateID.Valid {
+		b.parents[item.ItemID] = uint64(templateID.Int64)
+	}
+	b.idx.items[item.ItemID] = &item
+	b.idx.bytes += itemOverhead + int64(len(item.Key)+len(item.Units))
+}
+
+func (b *builder) addItemTag(itemID uint64, tag record.Tag) {
+	if item, ok := b.idx.items[itemID]; ok {
+		item.Tags = append(item.Tags, tag)
+		b.idx.bytes += entryOverhead + int64(len(tag.Tag)+len(tag.Value))
+	}
+}
+
+func (b *builder) addHost(h *HostMeta) {
+	b.idx.hosts[h.HostID] = h
+	b.idx.hostsByName[h.Host] = h
+	b.idx.bytes += hostOverhead + int64(len(h.Host)+len(h.Name))
+}
+
+func (b *builder) addGroup(hostID uint64, name string) {
+	if h, ok := b.idx.hosts[hostID]; ok {
+		h.Groups = append(h.Groups, name)
+		b.idx.bytes += entryOverhead + int64(len(name))
+	}
+}
+
+// addInterface 只使用默认接口 类型值小的优先
+func (b *builder) addInterface(hostID uint64, main, typ int, ip string) {
+	h, ok := b.idx.hosts[hostID]
+	if !ok || main != 1 || ip == "" {
+		return
+	}
+	if t, ok := b.ipTypes[hostID]; ok && t <= typ {
+		return
+	}
+	b.idx.bytes += int64(len(ip) - len(h.IP))
+	h.IP = ip
+	b.ipTypes[hostID] = typ
+}
+
+func (b *builder) addHostTag(hostID uint64, tag record.Tag) {
+	if h, ok := b.idx.hosts[hostID]; ok {
+		h.Tags = append(h.Tags, tag)
+		b.idx.bytes += entryOverhead + int64(len(tag.Tag)+len(tag.Value))
+	}
+}
+
+// addInventory values 与 inventoryFields 一一对应
+func (b *builder) addInventory(hostID uint64, values []string) {
+	h, ok := b.idx.hosts[hostID]
+	if !ok {
+		return
+	}
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		if h.Inventory == nil {
+			h.Inventory = make(map[string]string)
+		}
+		h.Inventory[inventoryFields[i]] = v
+		b.idx.bytes += entryOverhead + int64(len(v))
+	}
+}
+
+func (b *builder) build() *Index {
+	for itemID, parent := range b.parents {
+		if hostID, ok := b.templateItems[parent]; ok {
+			b.idx.items[itemID].Template = b.templates[hostID]
+		}
+	}
+	for _, h := range b.idx.hosts {
+		sort.Strings(h.Groups)
+	}
+	return b.idx
+}
+
+// LoadIndex 从 sqlite 缓存构建内存索引
+func LoadIndex(s *sql.DB) (*Index, error) {
+	b := newBuilder()
+	err := scanAll(s, "hosts", "SELECT hostid, template_name FROM hosts", func(rows *sql.Rows) error {
+		var (
+			id   uint64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		b.addTemplate(id, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "items", "SELECT itemid, hostid, key_, templateid, units FROM items", func(rows *sql.Rows) error {
+		var (
+			item       ItemMeta
+			templateID sql.NullInt64
+		)
+		if err := rows.Scan(&item.ItemID, &item.HostID, &item.Key, &templateID, &item.Units); err != nil {
+			return err
+		}
+		b.addItem(item, templateID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "item_tags", "SELECT itemid, tag, value FROM item_tags", func(rows *sql.Rows) error {
+		var (
+			id  uint64
+			tag record.Tag
+		)
+		if err := rows.Scan(&id, &tag.Tag, &tag.Value); err != nil {
+			return err
+		}
+		b.addItemTag(id, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "monitored_hosts", "SELECT hostid, host, name FROM monitored_hosts", func(rows *sql.Rows) error {
+		h := &HostMeta{}
+		if err := rows.Scan(&h.HostID, &h.Host, &h.Name); err != nil {
+			return err
+		}
+		b.addHost(h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "host_groups", "SELECT hostid, name FROM host_groups", func(rows *sql.Rows) error {
+		var (
+			id   uint64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		b.addGroup(id, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "interfaces", "SELECT hostid, main, type, ip FROM interfaces WHERE main = 1 AND ip <> ''", func(rows *sql.Rows) error {
+		var (
+			id        uint64
+			main, typ int
+			ip        string
+		)
+		if err := rows.Scan(&id, &main, &typ, &ip); err != nil {
+			return err
+		}
+		b.addInterface(id, main, typ, ip)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(s, "host_tags", "SELECT hostid, tag, value FROM host_tags", func(rows *sql.Rows) error {
+		var (
+			id  uint64
+			tag record.Tag
+		)
+		if err := rows.Scan(&id, &tag.Tag, &tag.Value); err != nil {
+			return err
+		}
+		b.addHostTag(id, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	queryStr := "SELECT hostid, location, location_lat, location_lon, site_city, site_country, site_rack, asset_tag, serialno_a, os FROM host_inventory"
+	err = scanAll(s, "host_inventory", queryStr, func(rows *sql.Rows) error {
+		var id uint64
+		values := make([]string, len(inventoryFields))
+		dest := []any{&id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		b.addInventory(id, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.build(), nil
+}
+
+// buildResolved 由按需查询的结果构建只包含这些监控项与主机的索引
+func buildResolved(r *sqlite.Resolved) *Index {
+	b := newBuilder()
+	for _, t := range r.Templates {
+		b.addTemplate(uint64(t.HostID), t.TemplateName)
+	}
+	for _, i := range r.Items {
+		b.addItem(ItemMeta{ItemID: uint64(i.ItemID), HostID: uint64(i.HostID), Key: i.Key, Units: i.Units}, i.TemplateID)
+	}
+	for _, t := range r.ItemTags {
+		b.addItemTag(uint64(t.ItemID), record.Tag{Tag: t.Tag, Value: t.Value})
+	}
+	for _, h := range r.Hosts {
+		b.addHost(&HostMeta{HostID: uint64(h.HostID), Host: h.Host, Name: h.Name})
+	}
+	for _, g := range r.Groups {
+		b.addGroup(uint64(g.HostID), g.Name)
+	}
+	for _, i := range r.Interfaces {
+		b.addInterface(uint64(i.HostID), i.Main, i.Type, i.IP)
+	}
+	for _, t := range r.HostTags {
+		b.addHostTag(uint64(t.HostID), record.Tag{Tag: t.Tag, Value: t.Value})
+	}
+	for _, v := range r.Inventory {
+		b.addInventory(uint64(v.HostID), []string{v.Location, v.LocationLat, v.LocationLon, v.SiteCity,
+			v.SiteCountry, v.SiteRack, v.AssetTag, v.SerialNoA, v.OS})
+	}
+	return b.build()
+}
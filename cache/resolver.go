@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"time"
+	"zabbix-source/cache/sqlite"
+	"zabbix-source/logger"
+)
+
+var (
+	defaultMissInterval  = time.Second
+	defaultMissBatchSize = 500
+	defaultNegativeTTL   = 10 * time.Minute
+	// missQueueBatches 待查询队列可以容纳的批数 队列满时丢弃 过期后重新加入
+	missQueueBatches = 20
+)
+
+// merge 返回包含两个索引全部数据的新索引 o 中的数据优先
+func (i *Index) merge(o *Index) *Index {
+	merged := &Index{
+		items:       make(map[uint64]*ItemMeta),
+		hosts:       make(map[uint64]*HostMeta),
+		hostsByName: make(map[string]*HostMeta),
+	}
+	for _, src := range []*Index{i, o} {
+		if src == nil {
+			continue
+		}
+		for id, m := range src.items {
+			merged.items[id] = m
+		}
+		for id, m := range src.hosts {
+			merged.hosts[id] = m
+		}
+		for name, m := range src.hostsByName {
+			merged.hostsByName[name] = m
+		}
+		merged.bytes += src.bytes
+	}
+	return merged
+}
+
+// prune 去掉 base 中已有的数据 全部去掉时返回 nil
+func (i *Index) prune(base *Index) *Index {
+	if i == nil {
+		return nil
+	}
+	pruned := &Index{
+		items:       make(map[uint64]*ItemMeta),
+		hosts:       make(map[uint64]*HostMeta),
+		hostsByName: make(map[string]*HostMeta),
+	}
+	for id, m := range i.items {
+		if _, ok := base.items[id]; !ok {
+			pruned.items[id] = m
+			pruned.bytes += itemOverhead + int64(len(m.Key))
+		}
+	}
+	for id, m := range i.hosts {
+		if _, ok := base.hosts[id]; !ok {
+			pruned.hosts[id] = m
+			pruned.hostsByName[m.Host] = m
+			pruned.bytes += hostOverhead + int64(len(m.Host)+len(m.Name))
+		}
+	}
+	if len(pruned.items) == 0 && len(pruned.hosts) == 0 {
+		return nil
+	}
+	return pruned
+}
+
+// miss 记录一个索引中没有的 itemid 等待按需查询
+// 已在队列中或在 negative_ttl 内查询过的 itemid 直接忽略
+func (s *Service) miss(itemID uint64) {
+	now := time.Now()
+	if v, ok := s.missed.Load(itemID); ok && now.Before(v.(time.Time)) {
+		return
+	}
+	s.missed.Store(itemID, now.Add(s.conf.NegativeTTL))
+	select {
+	case s.misses <- itemID:
+	default:
+		s.missed.Delete(itemID)
+	}
+}
+
+// runResolver 每个 miss_interval 最多查询一批未知的 itemid
+func (s *Service) runResolver() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.conf.MissInterval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var batch []uint64
+	drain:
+		for len(batch) < s.conf.MissBatchSize {
+			select {
+			case id := <-s.misses:
+				batch = append(batch, id)
+			default:
+				break drain
+			}
+		}
+		if len(batch) > 0 {
+			s.resolve(batch)
+		}
+		if time.Since(lastPurge) >= s.conf.NegativeTTL {
+			s.purgeMissed()
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// resolve 从 Zabbix 查询一批 itemid 写入 sqlite 并立即加入覆盖索引
+// 查询失败时这些 itemid 可以重新加入队列 不存在的 itemid 保留到 negative_ttl 过期
+func (s *Service) resolve(batch []uint64) {
+	retry := func() {
+		for _, id := range batch {
+			s.missed.Delete(id)
+		}
+	}
+	zdb, err := s.zabbixDB()
+	if err != nil {
+		logger.Warnf("cache resolve skipped, zabbix db unavailable: %v", err)
+		retry()
+		return
+	}
+	r, err := sqlite.Resolve(zdb, batch)
+	if err != nil {
+		logger.Errorf("cache resolve %d items failed: %v", len(batch), err)
+		retry()
+		return
+	}
+	found := r.Found()
+	if len(found) > 0 {
+		if err := sqlite.Save(s.sqlite, r); err != nil {
+			logger.Errorf("cache save resolved items failed: %v", err)
+		}
+		s.overlayMu.Lock()
+		s.overlay.Store(s.overlay.Load().merge(buildResolved(r)))
+		s.overlayMu.Unlock()
+	}
+	for id := range found {
+		s.missed.Delete(id)
+	}
+	logger.Infof("cache resolved %d of %d unknown items", len(found), len(batch))
+}
+
+// purgeMissed 清理已经过期的记录
+func (s *Service) purgeMissed() {
+	now := time.Now()
+	s.missed.Range(func(k, v any) bool {
+		if now.After(v.(time.Time)) {
+			s.missed.Delete(k)
+		}
+		return true
+	})
+}
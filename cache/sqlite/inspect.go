@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// tables 缓存中的全部表 按同步顺序排列
+var tables = []table{hostsTable, itemsTable, monitoredHostsTable, hostGroupsTable, interfacesTable, hostTagsTable, itemTagsTable, inventoryTable}
+
+// TableNames 返回缓存中全部表的名称
+func TableNames() []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	return names
+}
+
+func lookupTable(name string) (table, error) {
+	for _, t := range tables {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return table{}, fmt.Errorf("unknown cache table %s", name)
+}
+
+// Count 返回表的行数
+func Count(sqlite *sql.DB, name string) (int, error) {
+	t, err := lookupTable(name)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = sqlite.QueryRow("SELECT COUNT(*) FROM " + t.name).Scan(&n)
+	return n, err
+}
+
+// Lookup 返回表中 column 等于 value 的行以及表的字段名 按主键排序
+func Lookup(sqlite *sql.DB, name, column string, value any) ([]string, [][]any, error) {
+	t, err := lookupTable(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(t.columns, column) {
+		return nil, nil, fmt.Errorf("cache table %s has no column %s", t.name, column)
+	}
+	queryStr := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? ORDER BY %s", strings.Join(t.columns, ", "), t.name, column, t.columns[0])
+	rows, err := sqlite.Query(queryStr, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var result [][]any
+	for rows.Next() {
+		values := make([]any, len(t.columns))
+		dest := make([]any, len(t.columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		for i := range values {
+			values[i] = normalize(values[i])
+		}
+		result = append(result, values)
+	}
+	return t.columns, result, rows.Err()
+}
@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"zabbix-source/db"
+)
+
+// MonitoredHostRecord 被监控的主机 status 0 启用 1 禁用
+type MonitoredHostRecord struct {
+	HostID int
+	Host   string
+	Name   string
+	Status int
+}
+
+// HostGroupRecord 主机与主机组的关联
+type HostGroupRecord struct {
+	HostGroupID int
+	HostID      int
+	GroupID     int
+	Name        string
+}
+
+// InterfaceRecord 主机接口 Main 为 1 时是同类型接口中的默认接口
+type InterfaceRecord struct {
+	InterfaceID int
+	HostID      int
+	Main        int
+	Type        int
+	UseIP       int
+	IP          string
+	DNS         string
+	Port        string
+}
+
+type HostTagRecord struct {
+	HostTagID int
+	HostID    int
+	Tag       string
+	Value     string
+}
+
+type ItemTagRecord struct {
+	ItemTagID int
+	ItemID    int
+	Tag       string
+	Value     string
+}
+
+// InventoryRecord 主机资产信息中用于补充维度的字段
+type InventoryRecord struct {
+	HostID      int
+	Location    string
+	LocationLat string
+	LocationLon string
+	SiteCity    string
+	SiteCountry string
+	SiteRack    string
+	AssetTag    string
+	SerialNoA   string
+	OS          string
+}
+
+// queryRows 执行查询 并将每一行交给 scan 处理
+func queryRows(zdb *db.DB, table, queryStr string, args []any, scan func(rows *sql.Rows) error) error {
+	rows, err := zdb.Query(queryStr, args...)
+	if err != nil {
+		return fmt.Errorf("query %s table failed: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("scan %s row failed: %w", table, err)
+		}
+	}
+	return rows.Err()
+}
+
+// QueryMonitoredHostTable 查询被监控的主机 不包含模板与主机原型 指定 hostids 时只查询这些主机
+func QueryMonitoredHostTable(zdb *db.DB, hostIDs ...uint64) ([]MonitoredHostRecord, error) {
+	var hosts []MonitoredHostRecord
+	queryStr, args := restrict(`select hostid, host, name, status from hosts where status in (0, 1) and flags <> 2`, "and", "hostid", hostIDs)
+	err := queryRows(zdb, "hosts", queryStr, args, func(rows *sql.Rows) error {
+		var h MonitoredHostRecord
+		if err := rows.Scan(&h.HostID, &h.Host, &h.Name, &h.Status); err != nil {
+			return err
+		}
+		hosts = append(hosts, h)
+		return nil
+	})
+	return hosts, err
+}
+
+// QueryHostGroupTable 查询 hosts_groups 以及对应的 hstgrp 名称
+func QueryHostGroupTable(zdb *db.DB, hostIDs ...uint64) ([]HostGroupRecord, error) {
+	var groups []HostGroupRecord
+	queryStr, args := restrict(`select hg.hostgroupid, hg.hostid, g.groupid, g.name from hosts_groups hg join hstgrp g on g.groupid = hg.groupid`, "where", "hg.hostid", hostIDs)
+	err := queryRows(zdb, "hosts_groups", queryStr, args, func(rows *sql.Rows) error {
+		var g HostGroupRecord
+		if err := rows.Scan(&g.HostGroupID, &g.HostID, &g.GroupID, &g.Name); err != nil {
+			return err
+		}
+		groups = append(groups, g)
+		return nil
+	})
+	return groups, err
+}
+
+// QueryInterfaceTable 查询 interface 表
+func QueryInterfaceTable(zdb *db.DB, hostIDs ...uint64) ([]InterfaceRecord, error) {
+	var interfaces []InterfaceRecord
+	queryStr, args := restrict(`select interfaceid, hostid, main, type, useip, ip, dns, port from interface`, "where", "hostid", hostIDs)
+	err := queryRows(zdb, "interface", queryStr, args, func(rows *sql.Rows) error {
+		var i InterfaceRecord
+		if err := rows.Scan(&i.InterfaceID, &i.HostID, &i.Main, &i.Type, &i.UseIP, &i.IP, &i.DNS, &i.Port); err != nil {
+			return err
+		}
+		interfaces = append(interfaces, i)
+		return nil
+	})
+	return interfaces, err
+}
+
+// QueryHostTagTable 查询 host_tag 表
+func QueryHostTagTable(zdb *db.DB, hostIDs ...uint64) ([]HostTagRecord, error) {
+	var tags []HostTagRecord
+	queryStr, args := restrict(`select hosttagid, hostid, tag, value from host_tag`, "where", "hostid", hostIDs)
+	err := queryRows(zdb, "host_tag", queryStr, args, func(rows *sql.Rows) error {
+		var t HostTagRecord
+		if err := rows.Scan(&t.HostTagID, &t.HostID, &t.Tag, &t.Value); err != nil {
+			return err
+		}
+		tags = append(tags, t)
+		return nil
+	})
+	return tags, err
+}
+
+// QueryItemTagTable 查询 item_tag 表 Zabbix 5.4 之前没有该表
+func QueryItemTagTable(zdb *db.DB, itemIDs ...uint64) ([]ItemTagRecord, error) {
+	var tags []ItemTagRecord
+	queryStr, args := restrict(`select itemtagid, itemid, tag, value from item_tag`, "where", "itemid", itemIDs)
+	err := queryRows(zdb, "item_tag", queryStr, args, func(rows *sql.Rows) error {
+		var t ItemTagRecord
+		if err := rows.Scan(&t.ItemTagID, &t.ItemID, &t.Tag, &t.Value); err != nil {
+			return err
+		}
+		tags = append(tags, t)
+		return nil
+	})
+	return tags, err
+}
+
+// QueryInventoryTable 查询 host_inventory 表
+func QueryInventoryTable(zdb *db.DB, hostIDs ...uint64) ([]InventoryRecord, error) {
+	var inventories []InventoryRecord
+	queryStr, args := restrict(`select hostid, location, location_lat, location_lon, site_city, site_country, site_rack, asset_tag, serialno_a, os from host_inventory`, "where", "hostid", hostIDs)
+	err := queryRows(zdb, "host_inventory", queryStr, args, func(rows *sql.Rows) error {
+		var i InventoryRecord
+		if err := rows.Scan(&i.HostID, &i.Location, &i.LocationLat, &i.LocationLon, &i.SiteCity,
+			&i.SiteCountry, &i.SiteRack, &i.AssetTag, &i.SerialNoA, &i.OS); err != nil {
+			return err
+		}
+		inventories = append(inventories, i)
+		return nil
+	})
+	return inventories, err
+}
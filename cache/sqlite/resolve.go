@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"zabbix-source/db"
+	"zabbix-source/logger"
+)
+
+// Resolved 按需从 Zabbix 查询到的监控项 以及它们所属主机与继承模板的元数据
+type Resolved struct {
+	Templates []HostRecord
+	// Items 包含查询的监控项以及它们直接继承的模板监控项
+	Items      []ItemRecord
+	ItemTags   []ItemTagRecord
+	Hosts      []MonitoredHostRecord
+	Groups     []HostGroupRecord
+	Interfaces []InterfaceRecord
+	HostTags   []HostTagRecord
+	Inventory  []InventoryRecord
+}
+
+// Found 返回查询到的监控项 id 不包含模板监控项
+func (r *Resolved) Found() map[uint64]struct{} {
+	templates := make(map[int]struct{}, len(r.Templates))
+	for _, t := range r.Templates {
+		templates[t.HostID] = struct{}{}
+	}
+	found := make(map[uint64]struct{}, len(r.Items))
+	for _, item := range r.Items {
+		if _, ok := templates[item.HostID]; !ok {
+			found[uint64(item.ItemID)] = struct{}{}
+		}
+	}
+	return found
+}
+
+func distinct[T any](records []T, id func(T) int) []uint64 {
+	seen := make(map[int]struct{}, len(records))
+	ids := make([]uint64, 0, len(records))
+	for _, r := range records {
+		if _, ok := seen[id(r)]; ok {
+			continue
+		}
+		seen[id(r)] = struct{}{}
+		ids = append(ids, uint64(id(r)))
+	}
+	return ids
+}
+
+// Resolve 只查询指定的监控项 以及它们的主机 主机组 接口 标签 资产和继承的模板
+// Zabbix 中不存在的 itemid 不会出现在结果中
+func Resolve(zdb *db.DB, itemIDs []uint64) (*Resolved, error) {
+	r := &Resolved{}
+	if len(itemIDs) == 0 {
+		return r, nil
+	}
+	items, err := QueryItemsTable(zdb, itemIDs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return r, nil
+	}
+	r.Items = items
+	var parents []ItemRecord
+	for _, item := range items {
+		if item.TemplateID.Valid {
+			parents = append(parents, item)
+		}
+	}
+	if parentIDs := distinct(parents, func(i ItemRecord) int { return int(i.TemplateID.Int64) }); len(parentIDs) > 0 {
+		templateItems, err := QueryItemsTable(zdb, parentIDs...)
+		if err != nil {
+			return nil, err
+		}
+		if hostIDs := distinct(templateItems, func(i ItemRecord) int { return i.HostID }); len(hostIDs) > 0 {
+			if r.Templates, err = QueryHostTable(zdb, hostIDs...); err != nil {
+				return nil, err
+			}
+		}
+		r.Items = append(r.Items, templateItems...)
+	}
+	if r.ItemTags, err = QueryItemTagTable(zdb, distinct(items, func(i ItemRecord) int { return i.ItemID })...); err != nil {
+		logger.Warnf("skip item tags for resolved items: %v", err)
+	}
+	hostIDs := distinct(items, func(i ItemRecord) int { return i.HostID })
+	if r.Hosts, err = QueryMonitoredHostTable(zdb, hostIDs...); err != nil {
+		return nil, err
+	}
+	if r.Groups, err = QueryHostGroupTable(zdb, hostIDs...); err != nil {
+		return nil, err
+	}
+	if r.Interfaces, err = QueryInterfaceTable(zdb, hostIDs...); err != nil {
+		return nil, err
+	}
+	if r.HostTags, err = QueryHostTagTable(zdb, hostIDs...); err != nil {
+		logger.Warnf("skip host tags for resolved hosts: %v", err)
+	}
+	if r.Inventory, err = QueryInventoryTable(zdb, hostIDs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Save 将按需查询的结果写入 sqlite 只新增或覆盖 不删除其他数据
+func Save(sqlite *sql.DB, r *Resolved) error {
+	tables := []struct {
+		table table
+		rows  [][]any
+	}{
+		{hostsTable, toRows(r.Templates, hostRow)},
+		{itemsTable, toRows(r.Items, itemRow)},
+		{itemTagsTable, toRows(r.ItemTags, itemTagRow)},
+		{monitoredHostsTable, toRows(r.Hosts, monitoredHostRow)},
+		{hostGroupsTable, toRows(r.Groups, hostGroupRow)},
+		{interfacesTable, toRows(r.Interfaces, interfaceRow)},
+		{hostTagsTable, toRows(r.HostTags, hostTagRow)},
+		{inventoryTable, toRows(r.Inventory, inventoryRow)},
+	}
+	for _, t := range tables {
+		w := &chunkWriter{sqlite: sqlite, size: defaultChunkSize, t: t.table}
+		for _, row := range t.rows {
+			for i := range row {
+				row[i] = normalize(row[i])
+			}
+			if err := w.exec(false, row...); err != nil {
+				return fmt.Errorf("upsert %s %v failed: %w", t.table.name, row[0], err)
+			}
+		}
+		if err := w.commit(); err != nil {
+			return fmt.Errorf("commit %s failed: %w", t.table.name, err)
+		}
+	}
+	return nil
+}
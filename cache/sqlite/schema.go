@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// schema 缓存表结构 表名与字段尽量与 Zabbix 保持一致
+// hosts 只保存模板 监控的主机保存在 monitored_hosts 中
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS hosts (
+		hostid INTEGER PRIMARY KEY,
+		template_name TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS items (
+		itemid INTEGER PRIMARY KEY,
+		hostid INTEGER NOT NULL,
+		key_ TEXT NOT NULL DEFAULT '',
+		templateid INTEGER,
+		units TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS items_hostid ON items (hostid)`,
+	`CREATE TABLE IF NOT EXISTS monitored_hosts (
+		hostid INTEGER PRIMARY KEY,
+		host TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS host_groups (
+		hostgroupid INTEGER PRIMARY KEY,
+		hostid INTEGER NOT NULL,
+		groupid INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS host_groups_hostid ON host_groups (hostid)`,
+	`CREATE TABLE IF NOT EXISTS interfaces (
+		interfaceid INTEGER PRIMARY KEY,
+		hostid INTEGER NOT NULL,
+		main INTEGER NOT NULL DEFAULT 0,
+		type INTEGER NOT NULL DEFAULT 0,
+		useip INTEGER NOT NULL DEFAULT 0,
+		ip TEXT NOT NULL DEFAULT '',
+		dns TEXT NOT NULL DEFAULT '',
+		port TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS interfaces_hostid ON interfaces (hostid)`,
+	`CREATE TABLE IF NOT EXISTS host_tags (
+		hosttagid INTEGER PRIMARY KEY,
+		hostid INTEGER NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		value TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS host_tags_hostid ON host_tags (hostid)`,
+	`CREATE TABLE IF NOT EXISTS item_tags (
+		itemtagid INTEGER PRIMARY KEY,
+		itemid INTEGER NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		value TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS item_tags_itemid ON item_tags (itemid)`,
+	`CREATE TABLE IF NOT EXISTS host_inventory (
+		hostid INTEGER PRIMARY KEY,
+		location TEXT NOT NULL DEFAULT '',
+		location_lat TEXT NOT NULL DEFAULT '',
+		location_lon TEXT NOT NULL DEFAULT '',
+		site_city TEXT NOT NULL DEFAULT '',
+		site_country TEXT NOT NULL DEFAULT '',
+		site_rack TEXT NOT NULL DEFAULT '',
+		asset_tag TEXT NOT NULL DEFAULT '',
+		serialno_a TEXT NOT NULL DEFAULT '',
+		os TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS meta (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL DEFAULT ''
+	)`,
+}
+
+// addedColumns 表创建之后新增的字段 旧版本创建的缓存文件打开时补充
+// 补充的字段在下一次同步时填入数据
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"items", "units", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// migrate 为旧的缓存文件补充新增的字段
+func migrate(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open 打开 sqlite 缓存文件 不存在时创建 并初始化表结构
+// 使用 WAL 模式 同步写入时不阻塞读取
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create cache dir failed: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s failed: %w", path, err)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("init sqlite schema failed: %w", err)
+		}
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate sqlite schema failed: %w", err)
+	}
+	return db, nil
+}
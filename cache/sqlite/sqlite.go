@@ -3,6 +3,8 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"zabbix-source/db"
 )
 
 type HostRecord struct {
@@ -15,11 +17,14 @@ type ItemRecord struct {
 	HostID     int
 	Key        string
 	TemplateID sql.NullInt64
+	// Units 监控项的单位 例如 B bps %
+	Units string
 }
 
-func QueryHostTable(mysql *sql.DB) ([]HostRecord, error) {
-	queryStr := `select hostid, name as template_name  from hosts where status =3`
-	rows, err := mysql.Query(queryStr)
+// QueryHostTable 查询模板 指定 hostids 时只查询这些模板
+func QueryHostTable(zdb *db.DB, hostIDs ...uint64) ([]HostRecord, error) {
+	queryStr, args := restrict(`select hostid, name as template_name  from hosts where status =3`, "and", "hostid", hostIDs)
+	rows, err := zdb.Query(queryStr, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query host table failed: %w", err)
 	}
@@ -36,32 +41,10 @@ func QueryHostTable(mysql *sql.DB) ([]HostRecord, error) {
 	return hosts, nil
 }
 
-// SyncHostsToSqlite 同步数据到 sqlite hosts 表
-// 同步数据前会全量删除 过去的旧内容
-func SyncHostsToSqlite(sqlite *sql.DB, hosts []HostRecord) error {
-	tx, err := sqlite.Begin()
-	if err != nil {
-		return err
-	}
-	tx.Exec("DELETE FROM hosts")
-	stmt, err := tx.Prepare("INSERT INTO hosts(hostid, template_name) VALUES (?, ?)")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	for _, h := range hosts {
-		if _, err := stmt.Exec(h.HostID, h.TemplateName); err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
-	return tx.Commit()
-}
-
-// QueryItemsTable 查询 items 表
-func QueryItemsTable(mysql *sql.DB) ([]ItemRecord, error) {
-	queryStr := `select itemid, hostid, key_, templateid from items`
-	rows, err := mysql.Query(queryStr)
+// QueryItemsTable 查询 items 表 指定 itemids 时只查询这些监控项
+func QueryItemsTable(zdb *db.DB, itemIDs ...uint64) ([]ItemRecord, error) {
+	queryStr, args := restrict(`select itemid, hostid, key_, templateid, units from items`, "where", "itemid", itemIDs)
+	rows, err := zdb.Query(queryStr, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query items table failed: %w", err)
 	}
@@ -70,7 +53,7 @@ func QueryItemsTable(mysql *sql.DB) ([]ItemRecord, error) {
 	var items []ItemRecord
 	for rows.Next() {
 		var item ItemRecord
-		if err := rows.Scan(&item.ItemID, &item.HostID, &item.Key, &item.TemplateID); err != nil {
+		if err := rows.Scan(&item.ItemID, &item.HostID, &item.Key, &item.TemplateID, &item.Units); err != nil {
 			return nil, fmt.Errorf("scan item row failed: %w", err)
 		}
 		items = append(items, item)
@@ -78,24 +61,16 @@ func QueryItemsTable(mysql *sql.DB) ([]ItemRecord, error) {
 	return items, nil
 }
 
-// SyncItemsToSqlite 同步数据到 sqlite items 表
-// 同步数据前会全量删除 过去的旧内容
-func SyncItemsToSqlite(sqlite *sql.DB, items []ItemRecord) error {
-	tx, err := sqlite.Begin()
-	if err != nil {
-		return err
+// restrict 为查询追加 column in (...) 条件 ids 为空时原样返回
+// keyword 为 where 或 and 取决于原查询是否已有 where 子句
+func restrict(queryStr, keyword, column string, ids []uint64) (string, []any) {
+	if len(ids) == 0 {
+		return queryStr, nil
 	}
-	tx.Exec("DELETE FROM items")
-	stmt, err := tx.Prepare("INSERT INTO items(itemid, hostid, key_, templateid) VALUES (?, ?, ?, ?)")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	for _, i := range items {
-		if _, err := stmt.Exec(i.ItemID, i.HostID, i.Key, i.TemplateID); err != nil {
-			tx.Rollback()
-			return err
-		}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
 	}
-	return tx.Commit()
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	return fmt.Sprintf("%s %s %s in (%s)", queryStr, keyword, column, placeholders), args
 }
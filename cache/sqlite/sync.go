@@ -0,0 +1,338 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"zabbix-source/db"
+	"zabbix-source/logger"
+)
+
+var defaultChunkSize = 5000
+
+// MetaLastSync meta 表中记录最后一次同步完成时间的键 值为 unix 时间戳
+const MetaLastSync = "last_sync"
+
+// Changes 单个表一次同步的变更数量
+type Changes struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+}
+
+func (c Changes) Total() int {
+	return c.Inserted + c.Updated + c.Deleted
+}
+
+// table 缓存表的结构 第一列为主键
+type table struct {
+	name    string
+	columns []string
+}
+
+var (
+	hostsTable          = table{"hosts", []string{"hostid", "template_name"}}
+	itemsTable          = table{"items", []string{"itemid", "hostid", "key_", "templateid", "units"}}
+	monitoredHostsTable = table{"monitored_hosts", []string{"hostid", "host", "name", "status"}}
+	hostGroupsTable     = table{"host_groups", []string{"hostgroupid", "hostid", "groupid", "name"}}
+	interfacesTable     = table{"interfaces", []string{"interfaceid", "hostid", "main", "type", "useip", "ip", "dns", "port"}}
+	hostTagsTable       = table{"host_tags", []string{"hosttagid", "hostid", "tag", "value"}}
+	itemTagsTable       = table{"item_tags", []string{"itemtagid", "itemid", "tag", "value"}}
+	inventoryTable      = table{"host_inventory", []string{"hostid", "location", "location_lat", "location_lon", "site_city",
+		"site_country", "site_rack", "asset_tag", "serialno_a", "os"}}
+)
+
+// normalize 将 Zabbix 与 sqlite 中读出的值统一为相同的类型 以便比较
+func normalize(v any) any {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case sql.NullInt64:
+		if !x.Valid {
+			return nil
+		}
+		return x.Int64
+	case []byte:
+		return string(x)
+	}
+	return v
+}
+
+// fingerprint 一行数据的比较值
+func fingerprint(values []any) string {
+	var b strings.Builder
+	for _, v := range values {
+		switch x := normalize(v).(type) {
+		case nil:
+			b.WriteString("n")
+		case int64:
+			b.WriteString("i")
+			b.WriteString(strconv.FormatInt(x, 10))
+		case string:
+			b.WriteString("s")
+			b.WriteString(strconv.Quote(x))
+		default:
+			fmt.Fprintf(&b, "v%v", x)
+		}
+		b.WriteByte('|')
+	}
+	return b.String()
+}
+
+// existing 读取 sqlite 表中现有数据的主键与比较值
+func (t table) existing(sqlite *sql.DB) (map[int64]string, error) {
+	rows, err := sqlite.Query("SELECT " + strings.Join(t.columns, ", ") + " FROM " + t.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	current := make(map[int64]string)
+	values := make([]any, len(t.columns))
+	dest := make([]any, len(t.columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		pk, ok := normalize(values[0]).(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected primary key %v", values[0])
+		}
+		current[pk] = fingerprint(values)
+	}
+	return current, rows.Err()
+}
+
+// chunkWriter 按固定语句数提交事务 避免长时间占用 sqlite 写锁
+type chunkWriter struct {
+	sqlite *sql.DB
+	size   int
+	n      int
+	tx     *sql.Tx
+	upsert *sql.Stmt
+	delete *sql.Stmt
+	t      table
+}
+
+func (w *chunkWriter) begin() error {
+	tx, err := w.sqlite.Begin()
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(w.t.columns)), ", ")
+	upsert, err := tx.Prepare(fmt.Sprintf("INSERT OR REPLACE INTO %s(%s) VALUES (%s)", w.t.name, strings.Join(w.t.columns, ", "), placeholders))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	del, err := tx.Prepare(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", w.t.name, w.t.columns[0]))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	w.tx, w.upsert, w.delete, w.n = tx, upsert, del, 0
+	return nil
+}
+
+func (w *chunkWriter) exec(del bool, args ...any) error {
+	if w.tx == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+	stmt := w.upsert
+	if del {
+		stmt = w.delete
+	}
+	if _, err := stmt.Exec(args...); err != nil {
+		w.rollback()
+		return err
+	}
+	w.n++
+	if w.n >= w.size {
+		return w.commit()
+	}
+	return nil
+}
+
+func (w *chunkWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	tx := w.tx
+	w.tx = nil
+	return tx.Commit()
+}
+
+func (w *chunkWriter) rollback() {
+	if w.tx != nil {
+		w.tx.Rollback()
+		w.tx = nil
+	}
+}
+
+// syncTable 对比 sqlite 中的数据 只写入新增与变化的行 并删除已经不存在的行
+func syncTable(sqlite *sql.DB, t table, rows [][]any, chunkSize int) (Changes, error) {
+	changes := Changes{}
+	current, err := t.existing(sqlite)
+	if err != nil {
+		return changes, fmt.Errorf("read cached %s failed: %w", t.name, err)
+	}
+	w := &chunkWriter{sqlite: sqlite, size: chunkSize, t: t}
+	seen := make(map[int64]struct{}, len(rows))
+	for _, row := range rows {
+		for i := range row {
+			row[i] = normalize(row[i])
+		}
+		pk := row[0].(int64)
+		seen[pk] = struct{}{}
+		old, ok := current[pk]
+		if ok && old == fingerprint(row) {
+			continue
+		}
+		if err := w.exec(false, row...); err != nil {
+			return changes, fmt.Errorf("upsert %s %d failed: %w", t.name, pk, err)
+		}
+		if ok {
+			changes.Updated++
+		} else {
+			changes.Inserted++
+		}
+	}
+	for pk := range current {
+		if _, ok := seen[pk]; ok {
+			continue
+		}
+		if err := w.exec(true, pk); err != nil {
+			return changes, fmt.Errorf("delete %s %d failed: %w", t.name, pk, err)
+		}
+		changes.Deleted++
+	}
+	if err := w.commit(); err != nil {
+		return changes, fmt.Errorf("commit %s failed: %w", t.name, err)
+	}
+	return changes, nil
+}
+
+func toRows[T any](records []T, row func(T) []any) [][]any {
+	rows := make([][]any, len(records))
+	for i, r := range records {
+		rows[i] = row(r)
+	}
+	return rows
+}
+
+func hostRow(h HostRecord) []any { return []any{h.HostID, h.TemplateName} }
+
+func itemRow(i ItemRecord) []any { return []any{i.ItemID, i.HostID, i.Key, i.TemplateID, i.Units} }
+
+func monitoredHostRow(h MonitoredHostRecord) []any { return []any{h.HostID, h.Host, h.Name, h.Status} }
+
+func hostGroupRow(g HostGroupRecord) []any { return []any{g.HostGroupID, g.HostID, g.GroupID, g.Name} }
+
+func interfaceRow(i InterfaceRecord) []any {
+	return []any{i.InterfaceID, i.HostID, i.Main, i.Type, i.UseIP, i.IP, i.DNS, i.Port}
+}
+
+func hostTagRow(t HostTagRecord) []any { return []any{t.HostTagID, t.HostID, t.Tag, t.Value} }
+
+func itemTagRow(t ItemTagRecord) []any { return []any{t.ItemTagID, t.ItemID, t.Tag, t.Value} }
+
+func inventoryRow(v InventoryRecord) []any {
+	return []any{v.HostID, v.Location, v.LocationLat, v.LocationLon, v.SiteCity, v.SiteCountry, v.SiteRack, v.AssetTag, v.SerialNoA, v.OS}
+}
+
+// source 一个缓存表的数据来源
+type source struct {
+	table table
+	query func(zdb *db.DB) ([][]any, error)
+	// optional 表不存在时跳过该表 用于只在部分 Zabbix 版本中存在的表
+	optional bool
+}
+
+var sources = []source{
+	{table: hostsTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryHostTable(zdb)
+		return toRows(r, hostRow), err
+	}},
+	{table: itemsTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryItemsTable(zdb)
+		return toRows(r, itemRow), err
+	}},
+	{table: monitoredHostsTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryMonitoredHostTable(zdb)
+		return toRows(r, monitoredHostRow), err
+	}},
+	{table: hostGroupsTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryHostGroupTable(zdb)
+		return toRows(r, hostGroupRow), err
+	}},
+	{table: interfacesTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryInterfaceTable(zdb)
+		return toRows(r, interfaceRow), err
+	}},
+	// host_tag 只在 Zabbix 4.2 之后存在 item_tag 只在 Zabbix 5.4 之后存在 表不存在时跳过
+	{table: hostTagsTable, optional: true, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryHostTagTable(zdb)
+		return toRows(r, hostTagRow), err
+	}},
+	{table: itemTagsTable, optional: true, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryItemTagTable(zdb)
+		return toRows(r, itemTagRow), err
+	}},
+	{table: inventoryTable, query: func(zdb *db.DB) ([][]any, error) {
+		r, err := QueryInventoryTable(zdb)
+		return toRows(r, inventoryRow), err
+	}},
+}
+
+// Sync 将 Zabbix 数据库中的元数据增量同步到 sqlite
+// 每个表单独对比 写入按 chunkSize 条语句分批提交 返回各表的变更数量
+func Sync(zdb *db.DB, sqlite *sql.DB, chunkSize int) (map[string]Changes, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	result := make(map[string]Changes, len(sources))
+	for _, s := range sources {
+		rows, err := s.query(zdb)
+		if err != nil {
+			if s.optional && db.IsTableNotExist(err) {
+				logger.Warnf("skip cache table %s: %v", s.table.name, err)
+				continue
+			}
+			return result, err
+		}
+		changes, err := syncTable(sqlite, s.table, rows, chunkSize)
+		result[s.table.name] = changes
+		if err != nil {
+			return result, err
+		}
+		if changes.Total() > 0 {
+			logger.Infof("cache sync %s: %d inserted, %d updated, %d deleted", s.table.name, changes.Inserted, changes.Updated, changes.Deleted)
+		}
+	}
+	if err := SetMeta(sqlite, MetaLastSync, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// SetMeta 写入 meta 表
+func SetMeta(sqlite *sql.DB, name, value string) error {
+	_, err := sqlite.Exec("INSERT OR REPLACE INTO meta(name, value) VALUES (?, ?)", name, value)
+	return err
+}
+
+// GetMeta 读取 meta 表 不存在时返回空字符串
+func GetMeta(sqlite *sql.DB, name string) (string, error) {
+	var value string
+	err := sqlite.QueryRow("SELECT value FROM meta WHERE name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"zabbix-source/cache/sqlite"
+	"zabbix-source/config"
+	"zabbix-source/db"
+	"zabbix-source/logger"
+)
+
+const cacheUsage = `usage: %s cache [-c config] [-path cache.db] <command> [args]
+
+commands:
+  stats              show row count of each table and last sync time
+  item <itemid>      show an item, its template chain, tags and host
+  host <hostid|host> show a monitored host with groups, interfaces, tags and inventory
+  template <name>    show templates with the given name and their item count
+  sync               sync the cache from the Zabbix database now, requires -c
+
+flags:
+`
+
+// runCache 实现 cache 子命令 直接读取 sqlite 缓存文件 用于排查元数据缺失的问题
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	cPath := fs.String("c", "", "relative path to config file")
+	path := fs.String("path", "", "sqlite cache file, overrides cache_config.path")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), cacheUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	var c *config.Config
+	if *cPath != "" {
+		var err error
+		if c, err = config.Parse(*cPath); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to parse config file:", err)
+			return 1
+		}
+		if *path == "" {
+			*path = c.CacheConfig.Path
+		}
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "cache path is required, use -c or -path")
+		return 2
+	}
+	// 只读命令不创建新文件 避免路径写错时得到一个空缓存
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open cache:", err)
+		return 1
+	}
+	s, err := sqlite.Open(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open cache:", err)
+		return 1
+	}
+	defer s.Close()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	w := os.Stdout
+	switch {
+	case cmd == "stats" && len(rest) == 0:
+		err = cacheStats(w, s)
+	case cmd == "item" && len(rest) == 1:
+		err = cacheItem(w, s, rest[0])
+	case cmd == "host" && len(rest) == 1:
+		err = cacheHost(w, s, rest[0])
+	case cmd == "template" && len(rest) == 1:
+		err = cacheTemplate(w, s, rest[0])
+	case cmd == "sync" && len(rest) == 0:
+		if c == nil {
+			fmt.Fprintln(os.Stderr, "sync requires -c to connect to the Zabbix database")
+			return 2
+		}
+		err = cacheSync(w, s, c)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func cacheStats(w io.Writer, s *sql.DB) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tROWS")
+	for _, name := range sqlite.TableNames() {
+		n, err := sqlite.Count(s, name)
+		if err != nil {
+			return fmt.Errorf("count %s failed: %w", name, err)
+		}
+		fmt.Fprintf(tw, "%s\t%d\n", name, n)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	last, err := sqlite.GetMeta(s, sqlite.MetaLastSync)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "last sync:", formatSyncTime(last))
+	return nil
+}
+
+func formatSyncTime(value string) string {
+	if value == "" {
+		return "never"
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	t := time.Unix(ts, 0)
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Truncate(time.Second))
+}
+
+// printRows 输出一个表中查到的行 没有数据时也输出表名 方便确认查过哪些表
+func printRows(w io.Writer, s *sql.DB, table, column string, value any) ([][]any, error) {
+	columns, rows, err := sqlite.Lookup(s, table, column, value)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s failed: %w", table, err)
+	}
+	fmt.Fprintf(w, "[%s] %s = %v\n", table, column, value)
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "  (none)")
+		fmt.Fprintln(w)
+		return nil, nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  "+strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			if v == nil {
+				values[i] = "NULL"
+			} else {
+				values[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(tw, "  "+strings.Join(values, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(w)
+	return rows, nil
+}
+
+func parseID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id %q", value)
+	}
+	return id, nil
+}
+
+// cacheItem 输出监控项 并沿 templateid 查找模板 与补充 template 维度时的规则一致
+func cacheItem(w io.Writer, s *sql.DB, value string) error {
+	itemID, err := parseID(value)
+	if err != nil {
+		return err
+	}
+	rows, err := printRows(w, s, "items", "itemid", itemID)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		fmt.Fprintf(w, "item %d is not cached, it will be resolved from the Zabbix database when its data arrives\n", itemID)
+		return nil
+	}
+	// items 的字段为 itemid hostid key_ templateid units
+	hostID, templateID := rows[0][1], rows[0][3]
+	template := "none, the item is not inherited from a template"
+	if templateID != nil {
+		parents, err := printRows(w, s, "items", "itemid", templateID)
+		if err != nil {
+			return err
+		}
+		template = fmt.Sprintf("unknown, template item %v is not cached", templateID)
+		if len(parents) > 0 {
+			templates, err := printRows(w, s, "hosts", "hostid", parents[0][1])
+			if err != nil {
+				return err
+			}
+			template = fmt.Sprintf("unknown, host %v of template item %v is not a cached template", parents[0][1], templateID)
+			if len(templates) > 0 {
+				template = fmt.Sprint(templates[0][1])
+			}
+		}
+	}
+	if _, err := printRows(w, s, "item_tags", "itemid", itemID); err != nil {
+		return err
+	}
+	if err := printHost(w, s, hostID); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "template dimension:", template)
+	return nil
+}
+
+func printHost(w io.Writer, s *sql.DB, hostID any) error {
+	for _, table := range []string{"monitored_hosts", "host_groups", "interfaces", "host_tags", "host_inventory"} {
+		if _, err := printRows(w, s, table, "hostid", hostID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheHost 参数为数字时按 hostid 查找 否则按主机的技术名称查找
+func cacheHost(w io.Writer, s *sql.DB, value string) error {
+	var hostID any
+	if id, err := parseID(value); err == nil {
+		hostID = id
+	} else {
+		_, rows, err := sqlite.Lookup(s, "monitored_hosts", "host", value)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			fmt.Fprintf(w, "host %q is not cached\n", value)
+			return nil
+		}
+		hostID = rows[0][0]
+	}
+	if err := printHost(w, s, hostID); err != nil {
+		return err
+	}
+	_, items, err := sqlite.Lookup(s, "items", "hostid", hostID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "items: %d\n", len(items))
+	return nil
+}
+
+func cacheTemplate(w io.Writer, s *sql.DB, name string) error {
+	templates, err := printRows(w, s, "hosts", "template_name", name)
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		_, items, err := sqlite.Lookup(s, "items", "hostid", t[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "template %v has %d items\n", t[0], len(items))
+	}
+	return nil
+}
+
+// cacheSync 立即执行一次完整同步 运行中的进程会在下一次同步或重启时加载新数据
+func cacheSync(w io.Writer, s *sql.DB, c *config.Config) error {
+	zdb, err := db.Open(c.ZabbixConfig.SQLConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect zabbix db: %w", err)
+	}
+	defer zdb.Close()
+	// 同步过程中的告警写入进程日志
+	logger.Init(c.LoggerConfig)
+	start := time.Now()
+	changes, err := sqlite.Sync(zdb, s, c.CacheConfig.ChunkSize)
+	if err != nil {
+		return fmt.Errorf("cache sync failed: %w", err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tINSERTED\tUPDATED\tDELETED")
+	for _, name := range sqlite.TableNames() {
+		if ch, ok := changes[name]; ok {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", name, ch.Inserted, ch.Updated, ch.Deleted)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nsynced in %s\n", time.Since(start).Truncate(time.Millisecond))
+	return nil
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/yaml.v2"
@@ -16,13 +18,46 @@ var (
 type SenderConfig map[string]any
 
 func (s SenderConfig) To(out interface{}) error {
-	return mapstructure.Decode(s, out)
+	return decode(s, out)
 }
 
 type SourceConfig map[string]any
 
 func (s SourceConfig) To(out interface{}) error {
-	return mapstructure.Decode(s, out)
+	return decode(s, out)
+}
+
+// ProcessorConfig 单个处理器的配置 type 指定处理器类型 其余字段由处理器自身解析
+type ProcessorConfig map[string]any
+
+// To 处理器配置中拼写错误的字段会让规则静默失效 因此不允许 type 以外的未知字段
+func (p ProcessorConfig) To(out interface{}) error {
+	in := maps.Clone(p)
+	delete(in, "type")
+	return decodeStrict(in, out)
+}
+
+// decode 将 map 形式的配置解析到结构体中
+// 支持 "1s" "500ms" 这类字符串直接解析为 time.Duration
+func decode(in interface{}, out interface{}) error {
+	return newDecoder(in, out, false)
+}
+
+// decodeStrict 与 decode 相同 存在结构体中没有的字段时返回错误
+func decodeStrict(in interface{}, out interface{}) error {
+	return newDecoder(in, out, true)
+}
+
+func newDecoder(in interface{}, out interface{}, errorUnused bool) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused: errorUnused,
+		Result:      out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(in)
 }
 
 // SQLConfig 数据库配置
@@ -34,23 +69,73 @@ type SQLConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	DbName   string `yaml:"db_name"`
+	// Socket unix socket 路径 设置后忽略 Host Port
+	// PostgreSQL 为 socket 所在的目录
+	Socket string `yaml:"socket"`
+	// SSLMode disable prefer require verify-ca verify-full
+	SSLMode string `yaml:"ssl_mode"`
+	// 连接池限制 为 0 时使用驱动的默认值
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
 }
 
 type ZabbixConfig struct {
 	SQLConfig SQLConfig `yaml:"sql_config"`
 }
 
+// CacheConfig 元数据缓存配置 Path 为空时不启用缓存
+type CacheConfig struct {
+	// Path sqlite 缓存文件路径
+	Path string `yaml:"path"`
+	// SyncInterval 从 Zabbix 数据库同步的间隔
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	// ChunkSize 同步时单个事务最多执行的写入语句数
+	ChunkSize int `yaml:"chunk_size"`
+	// MemoryLimit 内存索引估算大小的告警阈值 单位字节 为 0 时不告警
+	MemoryLimit int64 `yaml:"memory_limit"`
+	// MissInterval 按需查询未知 itemid 的最小间隔 每个间隔最多查询一批
+	MissInterval time.Duration `yaml:"miss_interval"`
+	// MissBatchSize 一次查询的 itemid 数量上限
+	MissBatchSize int `yaml:"miss_batch_size"`
+	// NegativeTTL Zabbix 中不存在的 itemid 在该时间内不再查询
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+}
+
 type LoggerConfig struct {
 	Level      string `yaml:"level"`
 	OutputPath string `yaml:"output_path"`
 }
 
+// RouteMatch 路由规则的匹配条件
+// 所有条件均为空时匹配全部记录
+type RouteMatch struct {
+	// Types 导出类型 history trends events
+	Types []string `yaml:"types"`
+	// Hosts 主机名 glob 匹配
+	Hosts []string `yaml:"hosts"`
+}
+
+// RouteRule 路由规则
+// 记录按规则顺序匹配 命中第一条规则后发送到规则中的全部 Sender
+type RouteRule struct {
+	Name    string         `yaml:"name"`
+	Match   RouteMatch     `yaml:"match"`
+	Senders []string       `yaml:"senders"`
+	DataID  int32          `yaml:"dataid"`
+	Options map[string]any `yaml:"options"`
+}
+
 type Config struct {
 	PidFilePath  string                  `yaml:"pid_file_path"`
 	ZabbixConfig ZabbixConfig            `yaml:"zabbix_config"`
+	CacheConfig  CacheConfig             `yaml:"cache_config"`
 	LoggerConfig LoggerConfig            `yaml:"logger_config"`
 	SenderConfig map[string]SenderConfig `yaml:"sender_config"`
 	SourceConfig map[string]SourceConfig `yaml:"source_config"`
+	RouteConfig  []RouteRule             `yaml:"route_config"`
+	// ProcessorConfig 按顺序执行的处理器 在元数据补充之后 路由之前执行
+	ProcessorConfig []ProcessorConfig `yaml:"processor_config"`
 }
 
 // Parse 解析配置文件
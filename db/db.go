@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"zabbix-source/config"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+var (
+	defaultMySQLPort    = 3306
+	defaultPostgresPort = 5432
+	pingTimeout         = 10 * time.Second
+)
+
+// Dialect 数据库方言 决定驱动 DSN 以及占位符的形式
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+)
+
+// 统一的 SSL 模式 与 PostgreSQL 的 sslmode 取值一致
+const (
+	SSLDisable    = "disable"
+	SSLPrefer     = "prefer"
+	SSLRequire    = "require"
+	SSLVerifyCA   = "verify-ca"
+	SSLVerifyFull = "verify-full"
+)
+
+// mysqlTLS 统一的 SSL 模式对应的 MySQL 驱动 tls 参数
+var mysqlTLS = map[string]string{
+	SSLDisable:    "false",
+	SSLPrefer:     "preferred",
+	SSLRequire:    "skip-verify",
+	SSLVerifyCA:   "true",
+	SSLVerifyFull: "true",
+}
+
+// ParseDialect 解析 db_type 为空时默认为 MySQL
+// TimescaleDB 与 PostgreSQL 使用相同的协议与表结构
+func ParseDialect(dbType string) (Dialect, error) {
+	switch strings.ToLower(dbType) {
+	case "", "mysql", "mariadb":
+		return MySQL, nil
+	case "postgres", "postgresql", "pgsql", "timescaledb":
+		return Postgres, nil
+	default:
+		return "", fmt.Errorf("unsupported db_type %s", dbType)
+	}
+}
+
+// Rebind 将 ? 占位符转换为方言对应的形式
+// 查询统一使用 ? 书写 PostgreSQL 转换为 $1 $2 引号中的 ? 保持原样
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var (
+		b     strings.Builder
+		n     int
+		quote byte
+	)
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// DB Zabbix 数据库连接 查询中的 ? 占位符会按方言自动转换
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.DB.Query(d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+// Open 根据 SQLConfig 连接 Zabbix 数据库 并检查连接是否可用
+func Open(conf config.SQLConfig) (*DB, error) {
+	dialect, err := ParseDialect(conf.DBType)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := DSN(dialect, conf)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s %s failed: %w", dialect, addr(conf), err)
+	}
+	if conf.MaxOpenConns > 0 {
+		conn.SetMaxOpenConns(conf.MaxOpenConns)
+	}
+	if conf.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(conf.MaxIdleConns)
+	}
+	if conf.ConnMaxLifetime > 0 {
+		conn.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping %s %s failed: %w", dialect, addr(conf), err)
+	}
+	return &DB{DB: conn, Dialect: dialect}, nil
+}
+
+func addr(conf config.SQLConfig) string {
+	if conf.Socket != "" {
+		return conf.Socket
+	}
+	return fmt.Sprintf("%s:%d", conf.Host, conf.Port)
+}
+
+// DSN 生成方言对应驱动的连接串
+func DSN(dialect Dialect, conf config.SQLConfig) (string, error) {
+	switch dialect {
+	case MySQL:
+		return mysqlDSN(conf)
+	case Postgres:
+		return postgresDSN(conf)
+	default:
+		return "", fmt.Errorf("unsupported dialect %s", dialect)
+	}
+}
+
+func mysqlDSN(conf config.SQLConfig) (string, error) {
+	c := mysql.NewConfig()
+	c.User = conf.UserName
+	c.Passwd = conf.Password
+	c.DBName = conf.DbName
+	if conf.Socket != "" {
+		c.Net = "unix"
+		c.Addr = conf.Socket
+	} else {
+		port := conf.Port
+		if port <= 0 {
+			port = defaultMySQLPort
+		}
+		c.Net = "tcp"
+		c.Addr = fmt.Sprintf("%s:%d", conf.Host, port)
+	}
+	if conf.SSLMode != "" {
+		tls, ok := mysqlTLS[conf.SSLMode]
+		if !ok {
+			return "", fmt.Errorf("unsupported ssl_mode %s", conf.SSLMode)
+		}
+		c.TLSConfig = tls
+	}
+	return c.FormatDSN(), nil
+}
+
+func postgresDSN(conf config.SQLConfig) (string, error) {
+	sslMode := conf.SSLMode
+	if sslMode == "" {
+		sslMode = SSLPrefer
+	}
+	// 统一的 SSL 模式即 PostgreSQL 的 sslmode 取值
+	if _, ok := mysqlTLS[sslMode]; !ok {
+		return "", fmt.Errorf("unsupported ssl_mode %s", conf.SSLMode)
+	}
+	// 使用 unix socket 时 host 为 socket 所在的目录
+	host := conf.Host
+	if conf.Socket != "" {
+		host = conf.Socket
+	}
+	port := conf.Port
+	if port <= 0 {
+		port = defaultPostgresPort
+	}
+	params := [][2]string{
+		{"host", host},
+		{"port", strconv.Itoa(port)},
+		{"user", conf.UserName},
+		{"password", conf.Password},
+		{"dbname", conf.DbName},
+		{"sslmode", sslMode},
+	}
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+		parts = append(parts, p[0]+"="+quote(p[1]))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// quote 按 libpq 连接串的规则转义参数值
+func quote(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// IsTableNotExist 判断错误是否为查询的表不存在
+// MySQL 错误码 1146 PostgreSQL SQLSTATE 42P01
+func IsTableNotExist(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1146
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42P01"
+	}
+	return false
+}
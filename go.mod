@@ -5,6 +5,10 @@ go 1.24.1
 require (
 	github.com/IBM/sarama v1.45.2
 	github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse v1.11.0
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/golang/snappy v0.0.4
+	github.com/lib/pq v1.12.3
+	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/sirupsen/logrus v1.9.3
@@ -12,6 +16,7 @@ require (
 )
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/BurntSushi/toml v1.5.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/eapache/go-resiliency v1.7.0 // indirect
@@ -19,7 +24,6 @@ require (
 	github.com/eapache/queue v1.1.0 // indirect
 	github.com/elastic/beats v7.1.1+incompatible // indirect
 	github.com/elastic/go-ucfg v0.7.0 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/hashicorp/go-uuid v1.0.3 // indirect
@@ -3,21 +3,105 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"zabbix-source/cache"
 	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/pipeline"
+	"zabbix-source/processor"
+	_ "zabbix-source/register"
+	"zabbix-source/router"
+	"zabbix-source/sender"
+	"zabbix-source/source"
+	"zabbix-source/utils"
 )
 
 var (
-	cPath = flag.String("c", "", "relative path to config file")
+	cPath  = flag.String("c", "", "relative path to config file")
+	dryRun = flag.Bool("dry-run", false, "print formatted payloads to stdout instead of sending them")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCache(os.Args[2:]))
+	}
 	flag.Parse()
 	if *cPath == "" {
 		fmt.Println("config file path is required")
 		return
 	}
-	_, err := config.Parse(*cPath)
+	c, err := config.Parse(*cPath)
 	if err != nil {
 		fmt.Println("failed to parse config file:", err)
+		return
+	}
+	logger.Init(c.LoggerConfig)
+	if *dryRun {
+		c.SenderConfig = sender.DryRunConfig(c.SenderConfig)
+	}
+	if c.PidFilePath != "" {
+		if err := utils.GenPid(c.PidFilePath); err != nil {
+			fmt.Println("failed to generate pid file:", err)
+			return
+		}
+	}
+	if err := run(c); err != nil {
+		logger.Errorf("zabbix source exit with error: %v", err)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(c *config.Config) error {
+	r, err := router.New(c.RouteConfig, c.SenderConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create router: %v", err)
+	}
+	senderService, err := sender.NewSenderService(c.SenderConfig)
+	if err != nil {
+		return err
+	}
+	defer senderService.Stop()
+	if err := senderService.Start(); err != nil {
+		return err
+	}
+	var stages []pipeline.Stage
+	if c.CacheConfig.Path != "" {
+		cacheService, err := cache.New(c.CacheConfig, c.ZabbixConfig.SQLConfig)
+		if err != nil {
+			return fmt.Errorf("failed to open cache: %v", err)
+		}
+		defer cacheService.Stop()
+		cacheService.Start()
+		stages = append(stages, cacheService)
+	}
+	processors, err := processor.New(c.ProcessorConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create processors: %v", err)
 	}
+	stages = append(stages, processors...)
+	sourceService, err := source.NewSourceService(c.SourceConfig)
+	if err != nil {
+		return err
+	}
+	p := pipeline.New(sourceService.Chan(), r, senderService, stages...)
+	p.Start()
+	if err := sourceService.Start(); err != nil {
+		sourceService.Stop()
+		p.Wait()
+		return err
+	}
+	logger.Infof("zabbix source started")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	logger.Infof("receive signal %s, stopping", sig)
+
+	// 先停止生产者 等待处理流程消费完毕后再停止 Sender
+	sourceService.Stop()
+	p.Wait()
+	return nil
 }
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"sync"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/router"
+	"zabbix-source/sender"
+)
+
+var (
+	worker = 3
+)
+
+// Stage 处理流程中的一个环节 例如元数据补充
+// 多个 worker 会并发调用 Process 返回 false 时丢弃该记录
+type Stage interface {
+	Process(rec *record.Record) bool
+}
+
+// Pipeline 连接 Source 与 Sender
+// 负责解析 Source 产生的原始数据 依次经过各个 Stage 后按路由规则分发给 Sender
+type Pipeline struct {
+	wg     sync.WaitGroup
+	in     <-chan []byte
+	stages []Stage
+	router *router.Router
+	out    *sender.SenderService
+}
+
+func New(in <-chan []byte, r *router.Router, out *sender.SenderService, stages ...Stage) *Pipeline {
+	return &Pipeline{
+		wg:     sync.WaitGroup{},
+		in:     in,
+		stages: stages,
+		router: r,
+		out:    out,
+	}
+}
+
+// Start 启动处理 goroutine
+// 输入 chan 关闭后 goroutine 退出
+func (p *Pipeline) Start() {
+	p.wg.Add(worker)
+	for idx := 0; idx < worker; idx++ {
+		go p.process(idx)
+	}
+}
+
+func (p *Pipeline) process(idx int) {
+	defer p.wg.Done()
+	for data := range p.in {
+		records, errs := record.ParseLines(data)
+		for _, err := range errs {
+			logger.Errorf("pipeline worker %d: %v", idx, err)
+		}
+		for _, rec := range records {
+			if !p.runStages(rec) {
+				continue
+			}
+			msg, ok, err := p.router.Route(rec)
+			if err != nil {
+				logger.Errorf("pipeline worker %d: %v", idx, err)
+				continue
+			}
+			if !ok {
+				logger.Debugf("pipeline worker %d: no route matched for record %s", idx, data)
+				continue
+			}
+			p.out.Push(msg)
+		}
+	}
+	logger.Infof("pipeline worker %d exit", idx)
+}
+
+func (p *Pipeline) runStages(rec *record.Record) bool {
+	for _, s := range p.stages {
+		if !s.Process(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Wait 等待全部处理 goroutine 退出
+func (p *Pipeline) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,307 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/pipeline"
+	"zabbix-source/processor"
+	"zabbix-source/record"
+)
+
+const (
+	ActionKeep = "keep"
+	ActionDrop = "drop"
+)
+
+// Range 数值范围 闭区间 未设置的一端不限制
+type Range struct {
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+}
+
+func (r *Range) empty() bool {
+	return r == nil || (r.Min == nil && r.Max == nil)
+}
+
+func (r *Range) contains(v float64) bool {
+	return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v <= *r.Max)
+}
+
+// Rule 过滤条件 同一个节点中设置的条件全部满足时匹配
+// And Or Not 用于组合子条件 与同一节点中的其他条件同样取交集
+// 未设置任何条件的节点匹配全部记录
+type Rule struct {
+	And []Rule `mapstructure:"and"`
+	Or  []Rule `mapstructure:"or"`
+	Not *Rule  `mapstructure:"not"`
+
+	// Types 导出类型 history trends events
+	Types []string `mapstructure:"types"`
+	// Hosts 主机的技术名称 glob 匹配任意一个即可
+	Hosts []string `mapstructure:"hosts"`
+	// HostRegex 主机的技术名称 正则匹配
+	HostRegex string `mapstructure:"host_regex"`
+	// Groups 主机组名称 glob 记录的任意一个主机组匹配任意一个即可
+	Groups []string `mapstructure:"groups"`
+	// ItemKeys 监控项 key glob 匹配任意一个即可
+	ItemKeys []string `mapstructure:"item_keys"`
+	// ItemKeyRegex 监控项 key 正则匹配
+	ItemKeyRegex string `mapstructure:"item_key_regex"`
+	// ItemTags 监控项标签 值为 glob 全部标签都存在且匹配时满足
+	// 事件记录使用事件的标签
+	ItemTags map[string]string `mapstructure:"item_tags"`
+	// ValueTypes Zabbix 值类型 0 浮点 1 字符 2 日志 3 整数 4 文本
+	ValueTypes []int `mapstructure:"value_types"`
+	// Severity 事件与日志监控项的严重级别范围
+	Severity *Range `mapstructure:"severity"`
+	// Value 数值范围 trends 使用平均值 非数值记录不满足
+	Value *Range `mapstructure:"value"`
+}
+
+type FilterConfig struct {
+	// Action keep 只保留匹配的记录 drop 丢弃匹配的记录
+	Action string `mapstructure:"action"`
+	Rule   Rule   `mapstructure:"rule"`
+}
+
+type matcher func(rec *record.Record) bool
+
+func all(ms []matcher) matcher {
+	return func(rec *record.Record) bool {
+		for _, m := range ms {
+			if !m(rec) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := processor.CompileGlob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile 将规则转换为匹配函数 配置错误时返回错误
+// 规则中没有任何有效条件 例如 hosts: [] or: [{}] 时匹配全部记录 返回 nil
+func compile(r Rule) (matcher, error) {
+	var ms []matcher
+	for i, sub := range r.And {
+		m, err := compile(sub)
+		if err != nil {
+			return nil, fmt.Errorf("and[%d]: %w", i, err)
+		}
+		if m != nil {
+			ms = append(ms, m)
+		}
+	}
+	if len(r.Or) > 0 {
+		var subs []matcher
+		matchAll := false
+		for i, sub := range r.Or {
+			m, err := compile(sub)
+			if err != nil {
+				return nil, fmt.Errorf("or[%d]: %w", i, err)
+			}
+			if m == nil {
+				matchAll = true
+			}
+			subs = append(subs, m)
+		}
+		if !matchAll {
+			ms = append(ms, func(rec *record.Record) bool {
+				for _, m := range subs {
+					if m(rec) {
+						return true
+					}
+				}
+				return false
+			})
+		}
+	}
+	if r.Not != nil {
+		m, err := compile(*r.Not)
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		if m == nil {
+			ms = append(ms, func(*record.Record) bool { return false })
+		} else {
+			ms = append(ms, func(rec *record.Record) bool { return !m(rec) })
+		}
+	}
+	if len(r.Types) > 0 {
+		types := make(map[record.ExportType]bool)
+		for _, t := range r.Types {
+			switch record.ExportType(t) {
+			case record.TypeHistory, record.TypeTrends, record.TypeEvents:
+				types[record.ExportType(t)] = true
+			default:
+				return nil, fmt.Errorf("unknown type %s", t)
+			}
+		}
+		ms = append(ms, func(rec *record.Record) bool { return types[rec.Type] })
+	}
+	if len(r.Hosts) > 0 {
+		res, err := compileGlobs(r.Hosts)
+		if err != nil {
+			return nil, fmt.Errorf("hosts: %w", err)
+		}
+		ms = append(ms, func(rec *record.Record) bool { return matchAny(res, rec.HostName()) })
+	}
+	if r.HostRegex != "" {
+		re, err := regexp.Compile(r.HostRegex)
+		if err != nil {
+			return nil, fmt.Errorf("host_regex: %w", err)
+		}
+		ms = append(ms, func(rec *record.Record) bool { return re.MatchString(rec.HostName()) })
+	}
+	if len(r.Groups) > 0 {
+		res, err := compileGlobs(r.Groups)
+		if err != nil {
+			return nil, fmt.Errorf("groups: %w", err)
+		}
+		ms = append(ms, func(rec *record.Record) bool {
+			for _, g := range rec.Groups {
+				if matchAny(res, g) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if len(r.ItemKeys) > 0 {
+		res, err := compileGlobs(r.ItemKeys)
+		if err != nil {
+			return nil, fmt.Errorf("item_keys: %w", err)
+		}
+		ms = append(ms, func(rec *record.Record) bool { return rec.ItemKey != "" && matchAny(res, rec.ItemKey) })
+	}
+	if r.ItemKeyRegex != "" {
+		re, err := regexp.Compile(r.ItemKeyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("item_key_regex: %w", err)
+		}
+		ms = append(ms, func(rec *record.Record) bool { return rec.ItemKey != "" && re.MatchString(rec.ItemKey) })
+	}
+	if len(r.ItemTags) > 0 {
+		tags := make(map[string]*regexp.Regexp, len(r.ItemTags))
+		for tag, pattern := range r.ItemTags {
+			re, err := processor.CompileGlob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("item_tags %s: %w", tag, err)
+			}
+			tags[tag] = re
+		}
+		ms = append(ms, func(rec *record.Record) bool {
+			recTags := rec.ItemTags
+			if rec.Type == record.TypeEvents {
+				recTags = rec.Tags
+			}
+			for tag, re := range tags {
+				// 同名标签可能有多个值 任意一个匹配即可
+				if !slices.ContainsFunc(recTags, func(t record.Tag) bool { return t.Tag == tag && re.MatchString(t.Value) }) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if len(r.ValueTypes) > 0 {
+		valueTypes := slices.Clone(r.ValueTypes)
+		ms = append(ms, func(rec *record.Record) bool {
+			return rec.Type != record.TypeEvents && slices.Contains(valueTypes, rec.ValueType)
+		})
+	}
+	if !r.Severity.empty() {
+		severity := *r.Severity
+		ms = append(ms, func(rec *record.Record) bool {
+			hasSeverity := rec.Type == record.TypeEvents || rec.ValueType == record.ValueTypeLog
+			return hasSeverity && severity.contains(float64(rec.Severity))
+		})
+	}
+	if !r.Value.empty() {
+		value := *r.Value
+		ms = append(ms, func(rec *record.Record) bool {
+			if rec.Type == record.TypeTrends {
+				return value.contains(rec.Avg)
+			}
+			v, ok := rec.NumericValue()
+			return ok && value.contains(v)
+		})
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	return all(ms), nil
+}
+
+// Filter 按规则保留或丢弃记录
+type Filter struct {
+	keep  bool
+	match matcher
+}
+
+func (f *Filter) Process(rec *record.Record) bool {
+	if f.match == nil {
+		return f.keep
+	}
+	return f.match(rec) == f.keep
+}
+
+func New(c FilterConfig) (*Filter, error) {
+	if c.Action == "" {
+		c.Action = ActionKeep
+	}
+	if c.Action != ActionKeep && c.Action != ActionDrop {
+		return nil, fmt.Errorf("unknown filter action %s", c.Action)
+	}
+	m, err := compile(c.Rule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter rule: %w", err)
+	}
+	// 空规则匹配全部记录 drop 时会丢弃全部数据
+	if c.Action == ActionDrop && m == nil {
+		return nil, fmt.Errorf("drop filter requires a non-empty rule")
+	}
+	return &Filter{keep: c.Action == ActionKeep, match: m}, nil
+}
+
+func init() {
+	if err := processor.RegisterProcessor("filter", newProcessor); err != nil {
+		fmt.Printf("failed to register filter processor: %v\n", err)
+	}
+}
+
+func newProcessor(conf config.ProcessorConfig) pipeline.Stage {
+	var c FilterConfig
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode filter processor config: %v", err)
+		return nil
+	}
+	f, err := New(c)
+	if err != nil {
+		logger.Errorf("failed to create filter processor: %v", err)
+		return nil
+	}
+	return f
+}
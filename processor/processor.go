@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"zabbix-source/config"
+	"zabbix-source/pipeline"
+)
+
+var processorFactory = make(map[string]func(config.ProcessorConfig) pipeline.Stage)
+
+func RegisterProcessor(name string, factory func(config.ProcessorConfig) pipeline.Stage) error {
+	_, ok := processorFactory[name]
+	if ok {
+		return fmt.Errorf("processor %s already registered", name)
+	}
+	processorFactory[name] = factory
+	return nil
+}
+
+// New 按配置顺序创建处理器 任意一个创建失败时返回错误
+func New(confs []config.ProcessorConfig) ([]pipeline.Stage, error) {
+	var stages []pipeline.Stage
+	for idx, c := range confs {
+		typ, _ := c["type"].(string)
+		if typ == "" {
+			return nil, fmt.Errorf("processor %d has no type", idx)
+		}
+		factory, ok := processorFactory[typ]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: type %s not registered", idx, typ)
+		}
+		stage := factory(c)
+		if stage == nil {
+			return nil, fmt.Errorf("failed to create processor %d of type %s", idx, typ)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// CompileGlob 将 glob 转换为完整匹配的正则
+// * 匹配任意字符 包括 / 与 [ ] 便于匹配监控项 key ? 匹配单个字符
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,107 @@
+package rewrite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseKey 解析 Zabbix 监控项 key 返回名称与参数
+// 例如 vfs.fs.size[/,pused] 解析为 vfs.fs.size 与 [/ pused]
+// 带引号的参数去掉引号并处理 \" 转义 数组参数 [a,b] 保留原文
+func ParseKey(key string) (string, []string, error) {
+	idx := strings.IndexByte(key, '[')
+	if idx < 0 {
+		return key, nil, nil
+	}
+	name := key[:idx]
+	if name == "" {
+		return "", nil, fmt.Errorf("item key %q has no name", key)
+	}
+	if !strings.HasSuffix(key, "]") {
+		return "", nil, fmt.Errorf("item key %q is not terminated by ]", key)
+	}
+	body := key[idx+1 : len(key)-1]
+	var (
+		params []string
+		i      int
+	)
+	for {
+		// 参数前的空格会被 Zabbix 忽略
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+		var (
+			param string
+			err   error
+		)
+		switch {
+		case i < len(body) && body[i] == '"':
+			param, i, err = quoted(body, i)
+		case i < len(body) && body[i] == '[':
+			param, i, err = array(body, i)
+		default:
+			end := strings.IndexByte(body[i:], ',')
+			if end < 0 {
+				end = len(body) - i
+			}
+			param, i = strings.TrimRight(body[i:i+end], " "), i+end
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("item key %q: %w", key, err)
+		}
+		params = append(params, param)
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+		if i >= len(body) {
+			return name, params, nil
+		}
+		if body[i] != ',' {
+			return "", nil, fmt.Errorf("item key %q has unexpected character %q at parameter %d", key, body[i], len(params))
+		}
+		i++
+	}
+}
+
+// quoted 读取从 start 开始的带引号参数 返回去掉引号后的值与结束位置
+func quoted(s string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '"':
+			b.WriteByte('"')
+			i++
+		case s[i] == '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted parameter")
+}
+
+// array 读取从 start 开始的数组参数 返回包括方括号的原文与结束位置
+// 数组元素可以带引号 引号内的 , 与 ] 不结束元素
+func array(s string, start int) (string, int, error) {
+	// elemStart 当前位置是否为元素的开头 只有元素开头的引号表示带引号的元素
+	elemStart := true
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == ' ' && elemStart:
+		case s[i] == '"' && elemStart:
+			_, end, err := quoted(s, i)
+			if err != nil {
+				return "", 0, err
+			}
+			i = end - 1
+			elemStart = false
+		case s[i] == ',':
+			elemStart = true
+		case s[i] == ']':
+			return s[start : i+1], i + 1, nil
+		default:
+			elemStart = false
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated array parameter")
+}
@@ -0,0 +1,50 @@
+package rewrite
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		name   string
+		params []string
+		err    bool
+	}{
+		{key: "agent.ping", name: "agent.ping"},
+		{key: "vfs.fs.size[/,pused]", name: "vfs.fs.size", params: []string{"/", "pused"}},
+		{key: "system.cpu.util[]", name: "system.cpu.util", params: []string{""}},
+		{key: "net.if.in[eth0,]", name: "net.if.in", params: []string{"eth0", ""}},
+		{key: "key[ a , b ]", name: "key", params: []string{"a", "b"}},
+		{key: `key["a,b",c]`, name: "key", params: []string{"a,b", "c"}},
+		{key: `key["say \"hi\""]`, name: "key", params: []string{`say "hi"`}},
+		{key: `key["a]b"]`, name: "key", params: []string{"a]b"}},
+		{key: "key[[a,b],c]", name: "key", params: []string{"[a,b]", "c"}},
+		{key: `key[["a]b",c],d]`, name: "key", params: []string{`["a]b",c]`, "d"}},
+		{key: `key[[ "a,]" , "b\"]"],d]`, name: "key", params: []string{`[ "a,]" , "b\"]"]`, "d"}},
+		{key: `key[[a"b],c]`, name: "key", params: []string{`[a"b]`, "c"}},
+		{key: "[a]", err: true},
+		{key: "key[a", err: true},
+		{key: `key["a]`, err: true},
+		{key: "key[[a,b]", err: true},
+		{key: `key[["a]",b]`, err: true},
+		{key: `key["a"b]`, err: true},
+	}
+	for _, tt := range tests {
+		name, params, err := ParseKey(tt.key)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseKey(%q) = %q %q, want error", tt.key, name, params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseKey(%q) error: %v", tt.key, err)
+			continue
+		}
+		if name != tt.name || !slices.Equal(params, tt.params) {
+			t.Errorf("ParseKey(%q) = %q %q, want %q %q", tt.key, name, params, tt.name, tt.params)
+		}
+	}
+}
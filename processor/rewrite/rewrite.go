@@ -0,0 +1,318 @@
+package rewrite
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/pipeline"
+	"zabbix-source/processor"
+	"zabbix-source/record"
+)
+
+// placeholder 模板中的引用 {1} 为第 1 个参数或捕获组 {key} 为 key 名称 其余为命名捕获组
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Rule 按监控项 key 设置指标名称与维度 Key 与 KeyRegex 二选一
+type Rule struct {
+	// Key key 名称的 glob 不包含参数部分
+	Key string `mapstructure:"key"`
+	// Params 依次匹配每个参数的 glob 缺少的参数按空字符串匹配
+	Params []string `mapstructure:"params"`
+	// KeyRegex 匹配完整 key 的正则 模板中可以引用捕获组
+	KeyRegex string `mapstructure:"key_regex"`
+	// Metric 指标名称模板 为空时不修改名称
+	Metric string `mapstructure:"metric"`
+	// Dimensions 维度名称到值模板 值为空的维度不添加
+	Dimensions map[string]string `mapstructure:"dimensions"`
+}
+
+// Fixture 创建处理器时校验规则的样例
+type Fixture struct {
+	ItemKey    string            `mapstructure:"item_key"`
+	Dimensions map[string]string `mapstructure:"dimensions"`
+	// Metric 期望的指标名称
+	Metric string `mapstructure:"metric"`
+	// Expect 期望的维度 值为空表示该维度不存在
+	Expect map[string]string `mapstructure:"expect"`
+}
+
+type RewriteConfig struct {
+	// Rules 按顺序匹配 使用第一条命中的规则
+	Rules []Rule `mapstructure:"rules"`
+	// RenameDimensions 维度重命名 在规则之后执行 包括 host itemid groups 等基础维度
+	RenameDimensions map[string]string `mapstructure:"rename_dimensions"`
+	// DropDimensions 删除的维度 glob 在重命名之后执行 包括基础维度
+	DropDimensions []string  `mapstructure:"drop_dimensions"`
+	Fixtures       []Fixture `mapstructure:"fixtures"`
+}
+
+type rule struct {
+	key    *regexp.Regexp
+	params []*regexp.Regexp
+	re     *regexp.Regexp
+	metric string
+	dims   map[string]string
+}
+
+// match 返回 key 是否命中规则 以及展开模板时使用的变量
+func (r *rule) match(key, name string, params []string) (map[string]string, bool) {
+	vars := map[string]string{"key": name}
+	if r.re != nil {
+		m := r.re.FindStringSubmatch(key)
+		if m == nil {
+			return nil, false
+		}
+		for i, v := range m[1:] {
+			vars[strconv.Itoa(i+1)] = v
+		}
+		for i, n := range r.re.SubexpNames() {
+			if n != "" {
+				vars[n] = m[i]
+			}
+		}
+		return vars, true
+	}
+	if !r.key.MatchString(name) {
+		return nil, false
+	}
+	for i, p := range r.params {
+		param := ""
+		if i < len(params) {
+			param = params[i]
+		}
+		if !p.MatchString(param) {
+			return nil, false
+		}
+	}
+	for i, p := range params {
+		vars[strconv.Itoa(i+1)] = p
+	}
+	return vars, true
+}
+
+func expand(tmpl string, vars map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(s string) string {
+		return vars[s[1:len(s)-1]]
+	})
+}
+
+// checkTemplate 检查模板中的引用 参数数量在运行时才知道 只检查捕获组
+func checkTemplate(tmpl string, re *regexp.Regexp) error {
+	for _, m := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+		ref := m[1]
+		if ref == "key" {
+			continue
+		}
+		if n, err := strconv.Atoi(ref); err == nil {
+			if n < 1 || (re != nil && n > re.NumSubexp()) {
+				return fmt.Errorf("template %q references missing group {%s}", tmpl, ref)
+			}
+			continue
+		}
+		if re == nil || re.SubexpIndex(ref) < 0 {
+			return fmt.Errorf("template %q references unknown name {%s}", tmpl, ref)
+		}
+	}
+	return nil
+}
+
+func compileRule(r Rule) (*rule, error) {
+	c := &rule{metric: r.Metric, dims: make(map[string]string, len(r.Dimensions))}
+	var err error
+	switch {
+	case r.Key != "" && r.KeyRegex != "":
+		return nil, fmt.Errorf("key and key_regex are exclusive")
+	case r.KeyRegex != "":
+		if len(r.Params) > 0 {
+			return nil, fmt.Errorf("params only works with key")
+		}
+		if c.re, err = regexp.Compile(r.KeyRegex); err != nil {
+			return nil, fmt.Errorf("key_regex: %w", err)
+		}
+	case r.Key != "":
+		if c.key, err = processor.CompileGlob(r.Key); err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+		for _, p := range r.Params {
+			re, err := processor.CompileGlob(p)
+			if err != nil {
+				return nil, fmt.Errorf("params: %w", err)
+			}
+			c.params = append(c.params, re)
+		}
+	default:
+		return nil, fmt.Errorf("key or key_regex is required")
+	}
+	if err := checkTemplate(r.Metric, c.re); err != nil {
+		return nil, err
+	}
+	for name, tmpl := range r.Dimensions {
+		if err := checkTemplate(tmpl, c.re); err != nil {
+			return nil, err
+		}
+		sanitized := record.SanitizeName(name)
+		if sanitized == "" {
+			return nil, fmt.Errorf("invalid dimension name %q", name)
+		}
+		c.dims[sanitized] = tmpl
+	}
+	return c, nil
+}
+
+// Rewriter 按监控项 key 重写指标名称 将 key 参数提取为维度 并重命名或删除维度
+type Rewriter struct {
+	rules   []*rule
+	renames map[string]string
+	drops   []*regexp.Regexp
+}
+
+func (r *Rewriter) Process(rec *record.Record) bool {
+	if rec.ItemKey != "" {
+		// 无法解析的 key 只能被 key_regex 规则匹配
+		name, params, err := ParseKey(rec.ItemKey)
+		if err != nil {
+			name, params = rec.ItemKey, nil
+		}
+		for _, ru := range r.rules {
+			vars, ok := ru.match(rec.ItemKey, name, params)
+			if !ok {
+				continue
+			}
+			if ru.metric != "" {
+				if name := record.SanitizeName(expand(ru.metric, vars)); name != "" {
+					rec.Metric = name
+				}
+			}
+			for name, tmpl := range ru.dims {
+				if v := expand(tmpl, vars); v != "" {
+					if rec.Dimensions == nil {
+						rec.Dimensions = make(map[string]string)
+					}
+					rec.Dimensions[name] = v
+				}
+			}
+			break
+		}
+	}
+	if len(r.renames) > 0 || len(r.drops) > 0 {
+		r.rewriteDims(rec)
+	}
+	return true
+}
+
+// rewriteDims 对包括基础维度在内的全部维度执行重命名与删除
+// 被重命名或删除的基础维度记录在 DropDims 中 重命名后的值写入附加维度
+func (r *Rewriter) rewriteDims(rec *record.Record) {
+	dims := rec.Dims()
+	// 重命名后的维度覆盖同名的原有维度
+	final := make(map[string]string, len(dims))
+	for name, v := range dims {
+		if _, ok := r.renames[name]; !ok {
+			final[name] = v
+		}
+	}
+	for name, v := range dims {
+		if to, ok := r.renames[name]; ok {
+			final[to] = v
+		}
+	}
+	for name := range final {
+		for _, re := range r.drops {
+			if re.MatchString(name) {
+				delete(final, name)
+				break
+			}
+		}
+	}
+	rec.Dimensions = nil
+	base := rec.Dims()
+	for name := range base {
+		if _, ok := final[name]; !ok {
+			rec.DropDims = append(rec.DropDims, name)
+		}
+	}
+	// 与基础维度相同的值不重复写入附加维度
+	for name, v := range final {
+		if bv, ok := base[name]; ok && bv == v {
+			delete(final, name)
+		}
+	}
+	if len(final) > 0 {
+		rec.Dimensions = final
+	}
+}
+
+// check 使用样例校验规则 返回全部不符合预期的样例
+func (r *Rewriter) check(fixtures []Fixture) error {
+	var failures []string
+	for i, f := range fixtures {
+		rec := &record.Record{Type: record.TypeHistory, ItemKey: f.ItemKey, Dimensions: maps.Clone(f.Dimensions)}
+		r.Process(rec)
+		if f.Metric != "" && rec.MetricName() != f.Metric {
+			failures = append(failures, fmt.Sprintf("fixture %d %s: metric %q, want %q", i, f.ItemKey, rec.MetricName(), f.Metric))
+		}
+		dims := rec.Dims()
+		for name, want := range f.Expect {
+			if got := dims[name]; got != want {
+				failures = append(failures, fmt.Sprintf("fixture %d %s: dimension %s %q, want %q", i, f.ItemKey, name, got, want))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func New(c RewriteConfig) (*Rewriter, error) {
+	r := &Rewriter{renames: make(map[string]string, len(c.RenameDimensions))}
+	for i, ru := range c.Rules {
+		compiled, err := compileRule(ru)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	for from, to := range c.RenameDimensions {
+		sanitized := record.SanitizeName(to)
+		if sanitized == "" {
+			return nil, fmt.Errorf("invalid dimension name %q in rename_dimensions", to)
+		}
+		r.renames[from] = sanitized
+	}
+	for _, p := range c.DropDimensions {
+		re, err := processor.CompileGlob(p)
+		if err != nil {
+			return nil, fmt.Errorf("drop_dimensions: %w", err)
+		}
+		r.drops = append(r.drops, re)
+	}
+	if err := r.check(c.Fixtures); err != nil {
+		return nil, fmt.Errorf("fixtures failed: %w", err)
+	}
+	return r, nil
+}
+
+func init() {
+	if err := processor.RegisterProcessor("rewrite", newProcessor); err != nil {
+		fmt.Printf("failed to register rewrite processor: %v\n", err)
+	}
+}
+
+func newProcessor(conf config.ProcessorConfig) pipeline.Stage {
+	var c RewriteConfig
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode rewrite processor config: %v", err)
+		return nil
+	}
+	r, err := New(c)
+	if err != nil {
+		logger.Errorf("failed to create rewrite processor: %v", err)
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,123 @@
+package rewrite
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"testing"
+	"zabbix-source/record"
+)
+
+func TestCheckTemplate(t *testing.T) {
+	re := regexp.MustCompile(`^net\.if\.(in|out)\[(?P<iface>[^,\]]+)`)
+	tests := []struct {
+		tmpl string
+		re   *regexp.Regexp
+		err  bool
+	}{
+		{tmpl: "{key}_{1}_{2}", re: nil},
+		{tmpl: "{9}", re: nil},
+		{tmpl: "{0}", re: nil, err: true},
+		{tmpl: "{iface}", re: nil, err: true},
+		{tmpl: "net_{1}", re: re},
+		{tmpl: "{iface}", re: re},
+		{tmpl: "{2}", re: re},
+		{tmpl: "{3}", re: re, err: true},
+		{tmpl: "{name}", re: re, err: true},
+		{tmpl: "plain", re: re},
+	}
+	for _, tt := range tests {
+		err := checkTemplate(tt.tmpl, tt.re)
+		if (err != nil) != tt.err {
+			t.Errorf("checkTemplate(%q, %v) error = %v, want error %v", tt.tmpl, tt.re, err, tt.err)
+		}
+	}
+}
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  bool
+	}{
+		{name: "key", rule: Rule{Key: "vfs.fs.*", Params: []string{"*", "pused"}, Metric: "disk_{2}", Dimensions: map[string]string{"mount": "{1}"}}},
+		{name: "key_regex", rule: Rule{KeyRegex: `^net\.if\.(in|out)\[(?P<iface>[^,\]]+)`, Metric: "net_{1}", Dimensions: map[string]string{"iface": "{iface}"}}},
+		{name: "missing key", rule: Rule{Metric: "m"}, err: true},
+		{name: "exclusive", rule: Rule{Key: "a", KeyRegex: "a"}, err: true},
+		{name: "params with key_regex", rule: Rule{KeyRegex: "a", Params: []string{"b"}}, err: true},
+		{name: "invalid key_regex", rule: Rule{KeyRegex: "("}, err: true},
+		{name: "unknown group in metric", rule: Rule{KeyRegex: "(a)", Metric: "{2}"}, err: true},
+		{name: "unknown name in dimension", rule: Rule{Key: "a", Dimensions: map[string]string{"d": "{iface}"}}, err: true},
+		{name: "invalid dimension name", rule: Rule{Key: "a", Dimensions: map[string]string{"-": "{1}"}}, err: true},
+	}
+	for _, tt := range tests {
+		_, err := compileRule(tt.rule)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: compileRule error = %v, want error %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRewriteDims(t *testing.T) {
+	newRecord := func() *record.Record {
+		return &record.Record{
+			Type:       record.TypeHistory,
+			Host:       &record.Host{Host: "web01", Name: "Web 01"},
+			ItemID:     42,
+			Groups:     []string{"Linux", "Web"},
+			Dimensions: map[string]string{"mount": "/", "fstype": "ext4"},
+		}
+	}
+	tests := []struct {
+		name    string
+		renames map[string]string
+		drops   []string
+		want    map[string]string
+		dropped []string
+	}{
+		{
+			name: "unchanged",
+			want: map[string]string{"host": "web01", "host_name": "Web 01", "itemid": "42", "groups": "Linux,Web", "mount": "/", "fstype": "ext4"},
+		},
+		{
+			name:    "rename base dimension",
+			renames: map[string]string{"host": "node"},
+			want:    map[string]string{"node": "web01", "host_name": "Web 01", "itemid": "42", "groups": "Linux,Web", "mount": "/", "fstype": "ext4"},
+			dropped: []string{"host"},
+		},
+		{
+			name:    "drop base and extra dimensions",
+			drops:   []string{"item*", "groups", "fs*"},
+			want:    map[string]string{"host": "web01", "host_name": "Web 01", "mount": "/"},
+			dropped: []string{"groups", "itemid"},
+		},
+		{
+			name:    "rename overrides existing dimension",
+			renames: map[string]string{"mount": "host"},
+			want:    map[string]string{"host": "/", "host_name": "Web 01", "itemid": "42", "groups": "Linux,Web", "fstype": "ext4"},
+		},
+		{
+			name:    "drop after rename",
+			renames: map[string]string{"host_name": "display"},
+			drops:   []string{"display"},
+			want:    map[string]string{"host": "web01", "itemid": "42", "groups": "Linux,Web", "mount": "/", "fstype": "ext4"},
+			dropped: []string{"host_name"},
+		},
+	}
+	for _, tt := range tests {
+		r, err := New(RewriteConfig{RenameDimensions: tt.renames, DropDimensions: tt.drops})
+		if err != nil {
+			t.Fatalf("%s: New: %v", tt.name, err)
+		}
+		rec := newRecord()
+		r.Process(rec)
+		if got := rec.Dims(); !maps.Equal(got, tt.want) {
+			t.Errorf("%s: dims = %v, want %v", tt.name, got, tt.want)
+		}
+		dropped := slices.Clone(rec.DropDims)
+		slices.Sort(dropped)
+		if !slices.Equal(dropped, tt.dropped) {
+			t.Errorf("%s: DropDims = %v, want %v", tt.name, dropped, tt.dropped)
+		}
+	}
+}
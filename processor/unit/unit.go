@@ -0,0 +1,298 @@
+package unit
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/pipeline"
+	"zabbix-source/processor"
+	"zabbix-source/record"
+)
+
+// 支持的换算
+const (
+	OpMultiply       = "multiply"
+	OpDivide         = "divide"
+	OpBytesToBits    = "bytes_to_bits"
+	OpRatioToPercent = "ratio_to_percent"
+	OpPercentToRatio = "percent_to_ratio"
+	// OpRate 计数器转换为每秒速率 需要同一监控项的上一个样本
+	// 处理流程的多个 worker 共享样本状态 乱序到达的样本与已保存的较新样本计算速率
+	OpRate = "rate"
+)
+
+var defaultMaxGap = 10 * time.Minute
+
+type Op struct {
+	Type string `mapstructure:"type"`
+	// Factor multiply 与 divide 使用的系数
+	Factor float64 `mapstructure:"factor"`
+}
+
+// Rule 按监控项 key 或单位匹配 两者都设置时需同时满足
+type Rule struct {
+	// ItemKeys 监控项 key glob 匹配任意一个即可
+	ItemKeys []string `mapstructure:"item_keys"`
+	// Units 监控项的单位 来自元数据缓存 完全一致时匹配
+	Units []string `mapstructure:"units"`
+	// Ops 依次执行的换算
+	Ops []Op `mapstructure:"ops"`
+	// SetUnits 换算后的单位 为空时不修改
+	SetUnits string `mapstructure:"set_units"`
+}
+
+type UnitConfig struct {
+	// Rules 按顺序匹配 使用第一条命中的规则
+	Rules []Rule `mapstructure:"rules"`
+	// MaxGap 计算速率时上一个样本的最大间隔 超过后重新开始计算
+	MaxGap time.Duration `mapstructure:"max_gap"`
+}
+
+type rule struct {
+	keys     []*regexp.Regexp
+	units    []string
+	ops      []Op
+	rate     bool
+	setUnits string
+}
+
+func (r *rule) match(rec *record.Record) bool {
+	if len(r.units) > 0 && !slices.Contains(r.units, rec.Units) {
+		return false
+	}
+	if len(r.keys) == 0 {
+		return true
+	}
+	for _, re := range r.keys {
+		if re.MatchString(rec.ItemKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRule(r Rule) (*rule, error) {
+	if len(r.ItemKeys) == 0 && len(r.Units) == 0 {
+		return nil, fmt.Errorf("item_keys or units is required")
+	}
+	if len(r.Ops) == 0 {
+		return nil, fmt.Errorf("ops is required")
+	}
+	c := &rule{units: r.Units, ops: r.Ops, setUnits: r.SetUnits}
+	for _, k := range r.ItemKeys {
+		re, err := processor.CompileGlob(k)
+		if err != nil {
+			return nil, fmt.Errorf("item_keys: %w", err)
+		}
+		c.keys = append(c.keys, re)
+	}
+	for i, op := range r.Ops {
+		switch op.Type {
+		case OpMultiply, OpDivide:
+			if op.Factor == 0 {
+				return nil, fmt.Errorf("ops[%d] %s requires a non-zero factor", i, op.Type)
+			}
+		case OpRate:
+			if i != 0 {
+				return nil, fmt.Errorf("ops[%d] rate must be the first op", i)
+			}
+			c.rate = true
+		case OpBytesToBits, OpRatioToPercent, OpPercentToRatio:
+		default:
+			return nil, fmt.Errorf("ops[%d] unknown type %s", i, op.Type)
+		}
+	}
+	return c, nil
+}
+
+// apply 执行除 rate 之外的换算
+func apply(ops []Op, v float64) float64 {
+	for _, op := range ops {
+		switch op.Type {
+		case OpMultiply:
+			v *= op.Factor
+		case OpDivide:
+			v /= op.Factor
+		case OpBytesToBits:
+			v *= 8
+		case OpRatioToPercent:
+			v *= 100
+		case OpPercentToRatio:
+			v /= 100
+		}
+	}
+	return v
+}
+
+// sample 计算速率使用的上一个样本
+type sample struct {
+	value float64
+	// raw uint 类型的原始值 超过 2^53 的计数器转为 float64 会丢失精度 差值使用整数计算
+	raw    uint64
+	isUint bool
+	ts     int64
+}
+
+// seriesKey 计算速率时区分监控项 trapper 等没有 itemid 的记录按主机与 key 区分
+type seriesKey struct {
+	itemID  uint64
+	host    string
+	itemKey string
+}
+
+func keyOf(rec *record.Record) seriesKey {
+	if rec.ItemID != 0 {
+		return seriesKey{itemID: rec.ItemID}
+	}
+	return seriesKey{host: rec.HostName(), itemKey: rec.ItemKey}
+}
+
+// Converter 对数值记录做单位换算
+// history 与 trends 都会换算 计数器转速率只用于 history
+type Converter struct {
+	rules  []*rule
+	maxGap time.Duration
+
+	mu        sync.Mutex
+	last      map[seriesKey]sample
+	lastSweep time.Time
+}
+
+func (c *Converter) Process(rec *record.Record) bool {
+	if !rec.IsNumeric() {
+		return true
+	}
+	for _, r := range c.rules {
+		if !r.match(rec) {
+			continue
+		}
+		return c.convert(r, rec)
+	}
+	return true
+}
+
+// convert 使用命中的规则换算 无法计算速率时丢弃记录
+func (c *Converter) convert(r *rule, rec *record.Record) bool {
+	ops := r.ops
+	if rec.Type == record.TypeTrends {
+		if r.rate {
+			return true
+		}
+		rec.Min, rec.Avg, rec.Max = apply(ops, rec.Min), apply(ops, rec.Avg), apply(ops, rec.Max)
+	} else {
+		v, ok := rec.NumericValue()
+		if !ok {
+			return true
+		}
+		if r.rate {
+			if v, ok = c.rate(rec, v); !ok {
+				return false
+			}
+			ops = ops[1:]
+		}
+		rec.SetNumericValue(apply(ops, v))
+		// 换算后可能出现小数
+		rec.ValueType = record.ValueTypeFloat
+	}
+	if r.setUnits != "" {
+		rec.Units = r.setUnits
+	}
+	return true
+}
+
+// rate 返回与上一个样本之间的每秒速率
+// 第一个样本 时间相同的重复样本 计数器回绕或重置 间隔过长时没有速率
+// 处理流程的 worker 之间不保证同一监控项的处理顺序 只保存最新的样本
+// 较旧的样本晚到时与已保存的样本计算这段时间的速率 不更新状态
+func (c *Converter) rate(rec *record.Record, v float64) (float64, bool) {
+	ts := rec.TimestampNs()
+	cur := sample{value: v, ts: ts}
+	if rec.ValueType == record.ValueTypeUint {
+		if u, err := strconv.ParseUint(string(rec.Value), 10, 64); err == nil {
+			cur.raw, cur.isUint = u, true
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= c.maxGap {
+		c.sweep(now)
+	}
+	key := keyOf(rec)
+	prev, ok := c.last[key]
+	switch {
+	case !ok || ts > prev.ts:
+		c.last[key] = cur
+	case ts == prev.ts:
+		return 0, false
+	default:
+		prev, cur = cur, prev
+	}
+	if !ok || time.Duration(cur.ts-prev.ts) > c.maxGap {
+		return 0, false
+	}
+	var delta float64
+	if cur.isUint && prev.isUint {
+		if cur.raw < prev.raw {
+			return 0, false
+		}
+		delta = float64(cur.raw - prev.raw)
+	} else {
+		if cur.value < prev.value {
+			return 0, false
+		}
+		delta = cur.value - prev.value
+	}
+	return delta / time.Duration(cur.ts-prev.ts).Seconds(), true
+}
+
+// sweep 清理长时间没有新样本的监控项 调用方持有锁
+func (c *Converter) sweep(now time.Time) {
+	c.lastSweep = now
+	expire := now.Add(-2 * c.maxGap).UnixNano()
+	for key, s := range c.last {
+		if s.ts < expire {
+			delete(c.last, key)
+		}
+	}
+}
+
+func New(conf UnitConfig) (*Converter, error) {
+	if conf.MaxGap <= 0 {
+		conf.MaxGap = defaultMaxGap
+	}
+	c := &Converter{maxGap: conf.MaxGap, last: make(map[seriesKey]sample), lastSweep: time.Now()}
+	for i, r := range conf.Rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+	return c, nil
+}
+
+func init() {
+	if err := processor.RegisterProcessor("unit", newProcessor); err != nil {
+		fmt.Printf("failed to register unit processor: %v\n", err)
+	}
+}
+
+func newProcessor(conf config.ProcessorConfig) pipeline.Stage {
+	var c UnitConfig
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode unit processor config: %v", err)
+		return nil
+	}
+	u, err := New(c)
+	if err != nil {
+		logger.Errorf("failed to create unit processor: %v", err)
+		return nil
+	}
+	return u
+}
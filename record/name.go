@@ -0,0 +1,29 @@
+package record
+
+import "strings"
+
+// SanitizeName 将任意字符串转换为合法的指标或维度名称
+// 只保留字母 数字 下划线 其余字符替换为下划线 连续的下划线合并
+// 例如 net.if.in[eth0,bytes] 转换为 net_if_in_eth0_bytes
+func SanitizeName(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	lastUnderscore := false
+	for _, c := range s {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !valid || c == '_' {
+			if !lastUnderscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			lastUnderscore = true
+			continue
+		}
+		b.WriteRune(c)
+		lastUnderscore = false
+	}
+	out := strings.TrimRight(b.String(), "_")
+	if out != "" && out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package record
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Point BlueKing 自定义上报的单个数据点
+// 时序数据使用 Metrics 字段 事件数据使用 EventName 与 Event 字段
+type Point struct {
+	EventName string             `json:"event_name,omitempty"`
+	Event     map[string]any     `json:"event,omitempty"`
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+	Target    string             `json:"target"`
+	Dimension map[string]string  `json:"dimension"`
+	Timestamp int64              `json:"timestamp"`
+}
+
+// MetricName 返回记录的指标名称
+// 优先使用处理流程设置的名称 其次为转换后的监控项 key 最后使用 itemid
+func (r *Record) MetricName() string {
+	if r.Metric != "" {
+		return r.Metric
+	}
+	if r.ItemKey != "" {
+		return SanitizeName(r.ItemKey)
+	}
+	return "item_" + strconv.FormatUint(r.ItemID, 10)
+}
+
+// Dims 返回记录的基础维度与附加维度 DropDims 中的基础维度不输出
+func (r *Record) Dims() map[string]string {
+	dims := make(map[string]string, len(r.Dimensions)+4)
+	if r.Host != nil {
+		dims["host"] = r.Host.Host
+		dims["host_name"] = r.Host.Name
+	}
+	if r.IP != "" {
+		dims["ip"] = r.IP
+	}
+	if r.ItemID != 0 {
+		dims["itemid"] = strconv.FormatUint(r.ItemID, 10)
+	}
+	if r.Type == TypeEvents {
+		dims["eventid"] = strconv.FormatUint(r.EventID, 10)
+		if len(r.Hosts) > 0 {
+			dims["host"] = r.Hosts[0].Host
+			dims["host_name"] = r.Hosts[0].Name
+		}
+	}
+	if len(r.Groups) > 0 {
+		dims["groups"] = strings.Join(r.Groups, ",")
+	}
+	for _, k := range r.DropDims {
+		delete(dims, k)
+	}
+	for k, v := range r.Dimensions {
+		dims[k] = v
+	}
+	return dims
+}
+
+// Point 将记录转换为 BlueKing 数据点
+// 数值类 history trends 转为时序数据 其余转为事件
+// 已知主机 IP 时以 IP 为目标 便于与 CMDB 匹配
+func (r *Record) Point() *Point {
+	target := r.IP
+	if target == "" {
+		target = r.HostName()
+	}
+	p := &Point{
+		Target:    target,
+		Dimension: r.Dims(),
+		Timestamp: r.TimestampMs(),
+	}
+	switch {
+	case r.Type == TypeTrends:
+		name := r.MetricName()
+		p.Metrics = map[string]float64{
+			name + "_min":   r.Min,
+			name + "_avg":   r.Avg,
+			name + "_max":   r.Max,
+			name + "_count": float64(r.Count),
+		}
+	case r.IsNumeric():
+		v, _ := r.NumericValue()
+		p.Metrics = map[string]float64{r.MetricName(): v}
+	case r.Type == TypeEvents:
+		p.EventName = r.Name
+		p.Event = map[string]any{
+			"content":  r.Name,
+			"severity": r.Severity,
+			"problem":  r.IsProblem(),
+		}
+		if r.PEventID != 0 {
+			p.Event["p_eventid"] = r.PEventID
+		}
+		for _, t := range r.Tags {
+			p.Dimension["tag_"+t.Tag] = t.Value
+		}
+	default:
+		p.EventName = r.MetricName()
+		p.Event = map[string]any{"content": r.StringValue()}
+		if r.ValueType == ValueTypeLog {
+			p.Event["source"] = r.Source
+			p.Event["severity"] = r.Severity
+		}
+	}
+	return p
+}
+
+// PointJSON 返回记录对应的 BlueKing 数据点 JSON
+func (r *Record) PointJSON() ([]byte, error) {
+	return json.Marshal(r.Point())
+}
@@ -0,0 +1,203 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ExportType Zabbix 实时导出的数据类型
+type ExportType string
+
+const (
+	TypeHistory ExportType = "history"
+	TypeTrends  ExportType = "trends"
+	TypeEvents  ExportType = "events"
+)
+
+// Zabbix 监控项的值类型
+const (
+	ValueTypeFloat = 0
+	ValueTypeStr   = 1
+	ValueTypeLog   = 2
+	ValueTypeUint  = 3
+	ValueTypeText  = 4
+)
+
+type Host struct {
+	Host string `json:"host"`
+	Name string `json:"name"`
+}
+
+type Tag struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// Record Zabbix 实时导出的一条记录
+// history trends problems 三类导出共用同一个结构 未出现的字段为零值
+type Record struct {
+	Type ExportType `json:"-"`
+
+	// history trends
+	Host      *Host    `json:"host,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	ItemTags  []Tag    `json:"item_tags,omitempty"`
+	ItemID    uint64   `json:"itemid,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Clock     int64    `json:"clock"`
+	Ns        int64    `json:"ns,omitempty"`
+	ValueType int      `json:"type,omitempty"`
+
+	// history 的值 根据 ValueType 可能为数值或字符串
+	// problems 中为 1 表示问题 0 表示恢复
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// history log 类型监控项
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Source    string `json:"source,omitempty"`
+
+	// trends
+	Count int64   `json:"count,omitempty"`
+	Min   float64 `json:"min,omitempty"`
+	Avg   float64 `json:"avg,omitempty"`
+	Max   float64 `json:"max,omitempty"`
+
+	// problems 以及 log 类型监控项
+	EventID  uint64 `json:"eventid,omitempty"`
+	PEventID uint64 `json:"p_eventid,omitempty"`
+	Severity int    `json:"severity,omitempty"`
+	Hosts    []Host `json:"hosts,omitempty"`
+	Tags     []Tag  `json:"tags,omitempty"`
+
+	// 以下字段不来自 Zabbix 导出 由处理流程补充
+	// ItemKey 监控项 key 来自元数据缓存
+	ItemKey string `json:"item_key,omitempty"`
+	// Metric 指标名称
+	Metric string `json:"metric,omitempty"`
+	// IP 主机默认接口的地址 来自元数据缓存 作为 BlueKing 的目标
+	IP string `json:"ip,omitempty"`
+	// Units 监控项的单位 来自元数据缓存 单位换算后随之修改
+	Units string `json:"units,omitempty"`
+	// Dimensions 附加维度
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	// DropDims 不输出的基础维度 由处理流程重命名或删除 host itemid 等维度时设置
+	DropDims []string `json:"-"`
+}
+
+// Parse 解析一行 Zabbix 实时导出的 NDJSON 数据
+func Parse(data []byte) (*Record, error) {
+	r := &Record{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("unmarshal record failed: %w", err)
+	}
+	// zabbix_sender 推送的数据没有 itemid 只有 key
+	hasItem := r.ItemID != 0 || r.ItemKey != ""
+	switch {
+	case !hasItem && r.EventID != 0:
+		r.Type = TypeEvents
+	case !hasItem:
+		return nil, fmt.Errorf("unknown record: neither itemid nor eventid present")
+	case r.Count != 0 || len(r.Value) == 0:
+		r.Type = TypeTrends
+	default:
+		r.Type = TypeHistory
+	}
+	return r, nil
+}
+
+// ParseLines 解析可能包含多行 NDJSON 的数据块
+// 解析失败的行会被跳过 错误通过返回值告知调用方
+func ParseLines(data []byte) ([]*Record, []error) {
+	var (
+		records []*Record
+		errs    []error
+	)
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		r, err := Parse(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, errs
+}
+
+// ExportJSON 返回带 export_type 字段的记录 JSON
+// Type 不在 Zabbix 导出格式中 对外输出完整记录时需要单独标明
+func (r *Record) ExportJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ExportType ExportType `json:"export_type"`
+		*Record
+	}{
+		ExportType: r.Type,
+		Record:     r,
+	})
+}
+
+// IsNumeric 判断记录是否为数值类型的 history 或 trends
+func (r *Record) IsNumeric() bool {
+	if r.Type == TypeTrends {
+		return true
+	}
+	return r.Type == TypeHistory && (r.ValueType == ValueTypeFloat || r.ValueType == ValueTypeUint)
+}
+
+// IsProblem 判断事件记录是问题还是恢复
+func (r *Record) IsProblem() bool {
+	return r.Type == TypeEvents && r.PEventID == 0 && string(r.Value) != "0"
+}
+
+// NumericValue 返回 history 记录的数值
+func (r *Record) NumericValue() (float64, bool) {
+	if !r.IsNumeric() || len(r.Value) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(string(r.Value), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// SetNumericValue 修改 history 记录的数值
+func (r *Record) SetNumericValue(v float64) {
+	r.Value = json.RawMessage(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// StringValue 返回记录值的字符串形式
+func (r *Record) StringValue() string {
+	var s string
+	if err := json.Unmarshal(r.Value, &s); err == nil {
+		return s
+	}
+	return string(r.Value)
+}
+
+// HostName 返回记录对应的主机名
+// 事件记录可能关联多个主机 取第一个
+func (r *Record) HostName() string {
+	if r.Host != nil {
+		return r.Host.Host
+	}
+	if len(r.Hosts) > 0 {
+		return r.Hosts[0].Host
+	}
+	return ""
+}
+
+// TimestampMs 返回毫秒时间戳
+func (r *Record) TimestampMs() int64 {
+	return r.Clock*1000 + r.Ns/int64(1e6)
+}
+
+// TimestampNs 返回纳秒时间戳
+func (r *Record) TimestampNs() int64 {
+	return r.Clock*int64(1e9) + r.Ns
+}
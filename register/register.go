@@ -1,6 +1,23 @@
 package register
 
 import (
+	_ "zabbix-source/processor/filter"
+	_ "zabbix-source/processor/rewrite"
+	_ "zabbix-source/processor/unit"
+	_ "zabbix-source/sender/elasticsearch"
+	_ "zabbix-source/sender/file"
 	_ "zabbix-source/sender/gse"
+	_ "zabbix-source/sender/http"
+	_ "zabbix-source/sender/influxdb"
+	_ "zabbix-source/sender/kafka"
+	_ "zabbix-source/sender/otlp"
+	_ "zabbix-source/sender/prometheus"
+	_ "zabbix-source/sender/stdout"
+	_ "zabbix-source/sender/zabbix"
+	_ "zabbix-source/source/file"
+	_ "zabbix-source/source/http"
 	_ "zabbix-source/source/kafka"
+	_ "zabbix-source/source/trapper"
+	_ "zabbix-source/source/zabbixapi"
+	_ "zabbix-source/source/zabbixdb"
 )
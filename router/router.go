@@ -0,0 +1,93 @@
+package router
+
+import (
+	"fmt"
+	"path"
+	"zabbix-source/config"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+)
+
+type rule struct {
+	conf  config.RouteRule
+	types map[record.ExportType]bool
+}
+
+func (r *rule) match(rec *record.Record) bool {
+	if len(r.types) > 0 && !r.types[rec.Type] {
+		return false
+	}
+	if len(r.conf.Match.Hosts) == 0 {
+		return true
+	}
+	host := rec.HostName()
+	for _, pattern := range r.conf.Match.Hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Router 根据路由规则决定记录发送到哪些 Sender
+type Router struct {
+	rules []*rule
+}
+
+// New 创建 Router
+// senders 为已配置的 Sender 实例 规则中引用未配置的实例时返回错误
+func New(rules []config.RouteRule, senders map[string]config.SenderConfig) (*Router, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no route rules provided")
+	}
+	r := &Router{}
+	for idx, c := range rules {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("rule_%d", idx)
+		}
+		if len(c.Senders) == 0 {
+			return nil, fmt.Errorf("route rule %s has no senders", c.Name)
+		}
+		for _, name := range c.Senders {
+			if _, ok := senders[name]; !ok {
+				return nil, fmt.Errorf("route rule %s references unknown sender %s", c.Name, name)
+			}
+		}
+		for _, pattern := range c.Match.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("route rule %s has invalid host pattern %s: %v", c.Name, pattern, err)
+			}
+		}
+		types := make(map[record.ExportType]bool)
+		for _, t := range c.Match.Types {
+			types[record.ExportType(t)] = true
+		}
+		r.rules = append(r.rules, &rule{conf: c, types: types})
+	}
+	return r, nil
+}
+
+// Route 返回记录命中的第一条规则生成的消息
+// 未命中任何规则时返回 false
+func (r *Router) Route(rec *record.Record) (sender.SenderMsg, bool, error) {
+	for _, ru := range r.rules {
+		if !ru.match(rec) {
+			continue
+		}
+		data, err := rec.PointJSON()
+		if err != nil {
+			return nil, false, fmt.Errorf("format record for route %s failed: %w", ru.conf.Name, err)
+		}
+		options := make(map[string]interface{}, len(ru.conf.Options)+3)
+		for k, v := range ru.conf.Options {
+			options[k] = v
+		}
+		options["route"] = ru.conf.Name
+		options["record"] = rec
+		if ru.conf.DataID > 0 {
+			options["dataid"] = ru.conf.DataID
+		}
+		return sender.NewMsg(data, options, ru.conf.Senders), true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"fmt"
+	"maps"
+	"zabbix-source/config"
+)
+
+// FormatSender stdout Sender 使用被替换的 Sender 格式化消息
+const FormatSender = "sender"
+
+// Formatter 由 Sender 实现 返回消息对应的实际发送内容 用于 dry-run 输出
+// 返回 nil 表示该 Sender 不会发送这条消息
+type Formatter interface {
+	Format(SenderMsg) ([]byte, error)
+}
+
+// DryRunConfig 将全部 Sender 实例替换为 stdout Sender
+// 实例名称保持不变 路由规则无需修改 也不会创建真实的连接
+// GSE 实例使用相同的批量配置输出 GSE 实际接收的 payload
+// 其余实例保留原始配置 由对应 Sender 格式化后输出实际发送的内容
+func DryRunConfig(conf map[string]config.SenderConfig) map[string]config.SenderConfig {
+	out := make(map[string]config.SenderConfig, len(conf))
+	for name, c := range conf {
+		dry := config.SenderConfig{
+			"type":  "stdout",
+			"label": name,
+		}
+		typ, _ := c["type"].(string)
+		if typ == "" {
+			typ = name
+		}
+		switch typ {
+		case primaryType:
+			dry["format"] = "gse"
+			if batch, ok := c["batch"]; ok {
+				dry["batch"] = batch
+			}
+		case "stdout":
+			out[name] = c
+			continue
+		default:
+			orig := maps.Clone(c)
+			orig["type"] = typ
+			dry["format"] = FormatSender
+			dry["sender"] = orig
+		}
+		out[name] = dry
+	}
+	return out
+}
+
+// NewFormatter 按原始配置创建 Sender 实例但不启动 用于格式化消息
+// Sender 的构造函数只校验配置 连接在 Run 中创建
+func NewFormatter(conf config.SenderConfig) (Formatter, error) {
+	typ, _ := conf["type"].(string)
+	factory, ok := senderFactory[typ]
+	if !ok {
+		return nil, fmt.Errorf("sender %s not registered", typ)
+	}
+	instance := factory(conf)
+	if instance == nil {
+		return nil, fmt.Errorf("failed to create sender %s", typ)
+	}
+	f, ok := instance.(Formatter)
+	if !ok {
+		return nil, fmt.Errorf("sender %s does not support formatting", typ)
+	}
+	return f, nil
+}
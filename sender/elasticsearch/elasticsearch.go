@@ -0,0 +1,370 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+)
+
+var (
+	buffer            = 500
+	defaultTimeout    = 30 * time.Second
+	defaultMaxDocs    = 500
+	defaultMaxLatency = time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	defaultIndex      = "zabbix-{type}-"
+	defaultDateFormat = "2006.01.02"
+)
+
+func init() {
+	if err := sender.RegisterSender("elasticsearch", NewEsSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type EsConfig struct {
+	// URLs Elasticsearch 地址 请求失败时依次尝试下一个地址
+	URLs     []string      `mapstructure:"urls"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	APIKey   string        `mapstructure:"api_key"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Buffer   int           `mapstructure:"buffer"`
+	// Index 索引名称前缀 支持 {type} 占位符 路由规则 options.index 优先
+	Index string `mapstructure:"index"`
+	// DateFormat 索引日期后缀的 Go 时间格式 日期取自记录的 clock
+	DateFormat string `mapstructure:"date_format"`
+	// MaxDocs 单次 bulk 请求最多包含的文档数
+	MaxDocs int `mapstructure:"max_docs"`
+	// MaxLatency 文档在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	// MaxRetries 整个请求或单个文档失败后的最大重试次数
+	MaxRetries int           `mapstructure:"max_retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+}
+
+// doc bulk 请求中的单个文档
+type doc struct {
+	index   string
+	id      string
+	body    []byte
+	retries int
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// EsSender 通过 _bulk 接口将事件与日志写入 Elasticsearch
+// 文档 id 由 eventid 或 itemid+clock+ns 生成 重复写入不会产生重复文档
+type EsSender struct {
+	cfg    EsConfig
+	wg     sync.WaitGroup
+	ch     chan *doc
+	client *http.Client
+	// ctx 在 Stop 时取消 用于中断重试等待
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewEsSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := EsConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode elasticsearch sender config: %v", err)
+		return nil
+	}
+	if len(c.URLs) == 0 {
+		logger.Errorf("elasticsearch sender urls is required")
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.Index == "" {
+		c.Index = defaultIndex
+	}
+	if c.DateFormat == "" {
+		c.DateFormat = defaultDateFormat
+	}
+	if c.MaxDocs <= 0 {
+		c.MaxDocs = defaultMaxDocs
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EsSender{
+		cfg:    c,
+		wg:     sync.WaitGroup{},
+		ch:     make(chan *doc, c.Buffer),
+		client: &http.Client{Timeout: c.Timeout},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (e *EsSender) Name() string {
+	return "elasticsearch"
+}
+
+func (e *EsSender) Run() error {
+	e.wg.Add(1)
+	go e.consume()
+	return nil
+}
+
+// docID 生成幂等的文档 id
+func docID(rec *record.Record) string {
+	if rec.Type == record.TypeEvents {
+		return strconv.FormatUint(rec.EventID, 10)
+	}
+	return strconv.FormatUint(rec.ItemID, 10) + "-" + strconv.FormatInt(rec.Clock, 10) + "-" + strconv.FormatInt(rec.Ns, 10)
+}
+
+func (e *EsSender) newDoc(rec *record.Record, options map[string]interface{}) (*doc, error) {
+	prefix := e.cfg.Index
+	if v, ok := options["index"].(string); ok && v != "" {
+		prefix = v
+	}
+	ts := time.Unix(rec.Clock, rec.Ns).UTC()
+	index := strings.ReplaceAll(prefix, "{type}", string(rec.Type)) + ts.Format(e.cfg.DateFormat)
+	// 数值与文本 history 写入同一个 value 字段会导致索引 mapping 冲突
+	// history 的值按类型分别写入 value_num 与 value_str
+	value := rec.Value
+	var (
+		valueNum json.RawMessage
+		valueStr *string
+	)
+	if rec.Type == record.TypeHistory {
+		value = nil
+		if rec.IsNumeric() {
+			valueNum = rec.Value
+		} else {
+			s := rec.StringValue()
+			valueStr = &s
+		}
+	}
+	body, err := json.Marshal(struct {
+		Timestamp  string            `json:"@timestamp"`
+		ExportType record.ExportType `json:"export_type"`
+		// Value 覆盖 Record 中的同名字段
+		Value    json.RawMessage `json:"value,omitempty"`
+		ValueNum json.RawMessage `json:"value_num,omitempty"`
+		ValueStr *string         `json:"value_str,omitempty"`
+		*record.Record
+	}{
+		Timestamp:  ts.Format(time.RFC3339Nano),
+		ExportType: rec.Type,
+		Value:      value,
+		ValueNum:   valueNum,
+		ValueStr:   valueStr,
+		Record:     rec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc{index: index, id: docID(rec), body: body}, nil
+}
+
+func (e *EsSender) consume() {
+	defer e.wg.Done()
+	var batch []*doc
+	ticker := time.NewTicker(e.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case d, ok := <-e.ch:
+			if !ok {
+				e.flush(batch)
+				logger.Infof("elasticsearch sender exiting")
+				return
+			}
+			batch = append(batch, d)
+			if len(batch) >= e.cfg.MaxDocs {
+				e.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+// flush 发送 bulk 请求
+// 部分文档失败时 只对可重试的文档再次发送
+func (e *EsSender) flush(batch []*doc) {
+	backoff := e.cfg.Backoff
+	for attempt := 0; len(batch) > 0; attempt++ {
+		url := strings.TrimRight(e.cfg.URLs[attempt%len(e.cfg.URLs)], "/") + "/_bulk"
+		resp, retryable, err := e.bulk(url, batch)
+		if err != nil {
+			if !retryable || attempt >= e.cfg.MaxRetries {
+				logger.Errorf("elasticsearch sender: drop %d docs after %d attempts: %v", len(batch), attempt+1, err)
+				return
+			}
+			logger.Warnf("elasticsearch sender: bulk request failed, retry in %s: %v", backoff, err)
+		} else {
+			batch = e.failed(batch, resp)
+			if len(batch) == 0 {
+				return
+			}
+			if attempt >= e.cfg.MaxRetries {
+				logger.Errorf("elasticsearch sender: drop %d failed docs after %d attempts", len(batch), attempt+1)
+				return
+			}
+			logger.Warnf("elasticsearch sender: %d docs failed, retry in %s", len(batch), backoff)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-e.ctx.Done():
+			logger.Errorf("elasticsearch sender: stopped while retrying, drop %d docs", len(batch))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// failed 返回 bulk 响应中需要重试的文档
+// 429 与 5xx 可以重试 其他错误记录日志后丢弃
+func (e *EsSender) failed(batch []*doc, resp *bulkResponse) []*doc {
+	if !resp.Errors {
+		return nil
+	}
+	var retry []*doc
+	for idx, item := range resp.Items {
+		if idx >= len(batch) {
+			break
+		}
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			d := batch[idx]
+			if (result.Status == http.StatusTooManyRequests || result.Status >= 500) && d.retries < e.cfg.MaxRetries {
+				d.retries++
+				retry = append(retry, d)
+				continue
+			}
+			logger.Errorf("elasticsearch sender: drop doc %s/%s status %d: %s", d.index, d.id, result.Status, result.Error)
+		}
+	}
+	return retry
+}
+
+// bulkBody 生成 bulk 请求体 每个文档一行 index 操作与一行文档内容
+func bulkBody(batch []*doc) ([]byte, error) {
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, d := range batch {
+		action := map[string]map[string]string{"index": {"_index": d.index, "_id": d.id}}
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+		body.Write(d.body)
+		body.WriteByte('\n')
+	}
+	return body.Bytes(), nil
+}
+
+func (e *EsSender) bulk(url string, batch []*doc) (*bulkResponse, bool, error) {
+	body, err := bulkBody(batch)
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.cfg.APIKey)
+	} else if e.cfg.Username != "" {
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(data[:min(len(data), 512)]))
+		return nil, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+	}
+	br := &bulkResponse{}
+	if err := json.Unmarshal(data, br); err != nil {
+		return nil, false, fmt.Errorf("unmarshal bulk response failed: %w", err)
+	}
+	return br, false, nil
+}
+
+// Format 返回记录对应的 bulk 请求内容 用于 dry-run
+func (e *EsSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	options := msg.GetOptions()
+	rec, ok := options["record"].(*record.Record)
+	if !ok {
+		return nil, nil
+	}
+	d, err := e.newDoc(rec, options)
+	if err != nil {
+		return nil, err
+	}
+	return bulkBody([]*doc{d})
+}
+
+func (e *EsSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("elasticsearch sender push failed: channel closed")
+		}
+	}()
+	options := msg.GetOptions()
+	rec, ok := options["record"].(*record.Record)
+	if !ok {
+		return
+	}
+	d, err := e.newDoc(rec, options)
+	if err != nil {
+		logger.Errorf("elasticsearch sender: build doc failed: %v", err)
+		return
+	}
+	e.ch <- d
+}
+
+func (e *EsSender) Stop() {
+	close(e.ch)
+	// 停止时不再等待重试
+	e.cancel()
+	e.wg.Wait()
+	logger.Infof("elasticsearch sender stopped")
+}
@@ -0,0 +1,205 @@
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/sender"
+
+	"github.com/natefinch/lumberjack"
+)
+
+var (
+	buffer        = 500
+	flushInterval = time.Second
+)
+
+const (
+	// FormatData 按原样写入消息数据 即发送给 GSE 的数据点
+	FormatData = "data"
+	// FormatEnvelope 写入包含 dataid 与路由名称的封装结构
+	FormatEnvelope = "envelope"
+)
+
+func init() {
+	if err := sender.RegisterSender("file", NewFileSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type FileConfig struct {
+	// Path 输出文件路径
+	Path string `mapstructure:"path"`
+	// Format 输出格式 data envelope
+	Format string `mapstructure:"format"`
+	Buffer int    `mapstructure:"buffer"`
+	// MaxSize 单个文件最大大小 单位 MB
+	MaxSize int `mapstructure:"max_size"`
+	// MaxBackups 保留的历史文件个数
+	MaxBackups int `mapstructure:"max_backups"`
+	// MaxAge 历史文件保留天数
+	MaxAge int `mapstructure:"max_age"`
+	// RotateInterval 按时间切割的间隔 为 0 时只按大小切割
+	RotateInterval time.Duration `mapstructure:"rotate_interval"`
+	// Compress 是否使用 gzip 压缩切割后的文件
+	Compress bool `mapstructure:"compress"`
+}
+
+type envelope struct {
+	DataID any             `json:"dataid,omitempty"`
+	Route  any             `json:"route,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// FileSender 将消息以 NDJSON 的形式写入本地文件
+// 用于归档以及核对实际发送给 GSE 的内容
+type FileSender struct {
+	cfg    FileConfig
+	wg     sync.WaitGroup
+	ch     chan sender.SenderMsg
+	out    *lumberjack.Logger
+	writer *bufio.Writer
+}
+
+func NewFileSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := FileConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode file sender config: %v", err)
+		return nil
+	}
+	if c.Path == "" {
+		logger.Errorf("file sender path is required")
+		return nil
+	}
+	if c.Format == "" {
+		c.Format = FormatData
+	}
+	if c.Format != FormatData && c.Format != FormatEnvelope {
+		logger.Errorf("file sender unknown format %s", c.Format)
+		return nil
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	out := &lumberjack.Logger{
+		Filename:   c.Path,
+		MaxSize:    c.MaxSize,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAge,
+		Compress:   c.Compress,
+	}
+	return &FileSender{
+		cfg:    c,
+		wg:     sync.WaitGroup{},
+		ch:     make(chan sender.SenderMsg, c.Buffer),
+		out:    out,
+		writer: bufio.NewWriter(out),
+	}
+}
+
+func (f *FileSender) Name() string {
+	return "file"
+}
+
+func (f *FileSender) Run() error {
+	if err := os.MkdirAll(filepath.Dir(f.cfg.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", f.cfg.Path, err)
+	}
+	f.wg.Add(1)
+	go f.consume()
+	return nil
+}
+
+// consume 单 goroutine 写入 保证文件内的顺序与接收顺序一致
+func (f *FileSender) consume() {
+	defer f.wg.Done()
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	var rotateC <-chan time.Time
+	if f.cfg.RotateInterval > 0 {
+		rotateTicker := time.NewTicker(f.cfg.RotateInterval)
+		defer rotateTicker.Stop()
+		rotateC = rotateTicker.C
+	}
+	for {
+		select {
+		case msg, ok := <-f.ch:
+			if !ok {
+				f.flush()
+				logger.Infof("file sender exiting")
+				return
+			}
+			f.write(msg)
+		case <-flushTicker.C:
+			f.flush()
+		case <-rotateC:
+			f.flush()
+			if err := f.out.Rotate(); err != nil {
+				logger.Errorf("file sender failed to rotate %s: %v", f.cfg.Path, err)
+			}
+		}
+	}
+}
+
+// Format 返回写入文件的一行 不包括换行
+func (f *FileSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	line := msg.GetData()
+	if f.cfg.Format != FormatEnvelope {
+		return line, nil
+	}
+	options := msg.GetOptions()
+	data, err := json.Marshal(envelope{
+		DataID: options["dataid"],
+		Route:  options["route"],
+		Data:   json.RawMessage(line),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	return data, nil
+}
+
+func (f *FileSender) write(msg sender.SenderMsg) {
+	line, err := f.Format(msg)
+	if err != nil {
+		logger.Errorf("file sender %v", err)
+		return
+	}
+	if _, err := f.writer.Write(line); err != nil {
+		logger.Errorf("file sender failed to write %s: %v", f.cfg.Path, err)
+		return
+	}
+	if err := f.writer.WriteByte('\n'); err != nil {
+		logger.Errorf("file sender failed to write %s: %v", f.cfg.Path, err)
+	}
+}
+
+func (f *FileSender) flush() {
+	if err := f.writer.Flush(); err != nil {
+		logger.Errorf("file sender failed to flush %s: %v", f.cfg.Path, err)
+	}
+}
+
+func (f *FileSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("file sender push failed: channel closed")
+		}
+	}()
+	f.ch <- msg
+}
+
+func (f *FileSender) Stop() {
+	close(f.ch)
+	f.wg.Wait()
+	if err := f.out.Close(); err != nil {
+		logger.Errorf("file sender failed to close %s: %v", f.cfg.Path, err)
+	}
+	logger.Infof("file sender stopped")
+}
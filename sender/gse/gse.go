@@ -1,12 +1,14 @@
 package gse
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 	"zabbix-source/config"
 	"zabbix-source/logger"
 	"zabbix-source/sender"
+	"zabbix-source/sender/gse/payload"
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/gse"
 )
@@ -34,9 +36,10 @@ func init() {
 }
 
 type GseConfig struct {
-	Worker   int    `mapstructure:"worker"`
-	Buffer   int    `mapstructure:"buffer"`
-	EndPoint string `mapstructure:"end_point"`
+	Worker   int                 `mapstructure:"worker"`
+	Buffer   int                 `mapstructure:"buffer"`
+	EndPoint string              `mapstructure:"end_point"`
+	Batch    payload.BatchConfig `mapstructure:"batch"`
 }
 
 type GseSender struct {
@@ -66,6 +69,7 @@ func NewGseSender(cfg config.SenderConfig) sender.SenderInstance {
 	if c.Worker > 0 {
 		worker = c.Worker
 	}
+	c.Batch.SetDefaults()
 	return &GseSender{
 		cfg:    c,
 		wg:     sync.WaitGroup{},
@@ -89,22 +93,43 @@ func (g *GseSender) Run() error {
 	return nil
 }
 
+// consume 消费消息并按 dataid 聚合为批次发送
+// 每条消息的数据为一个 JSON 格式的数据点
 func (g *GseSender) consume(idx int) {
 	defer g.wg.Done()
-	for msg := range g.ch {
-		options := msg.GetOptions()
-		dataid, ok := options["dataid"].(int32)
-		if !ok {
-			logger.Errorf("GSE sender worker %d: missing or invalid dataid", idx)
-			logger.Debugf("GSE sender worker %d, drop msg %s ,options: %v", idx, msg.GetData(), options)
-			continue
+	batcher := payload.NewBatcher(g.cfg.Batch, func(dataid int32, data []byte, count int) {
+		if err := g.client.Send(gse.NewGseCommonMsg(data, dataid, 0, 0, 0)); err != nil {
+			logger.Errorf("GSE sender worker %d: failed to send %d records for dataid %d: %v", idx, count, dataid, err)
 		}
-		if err := g.client.Send(gse.NewGseCommonMsg(msg.GetData(), dataid, 0, 0, 0)); err != nil {
-			logger.Errorf("GSE sender worker %d: failed to send message: %v", idx, err)
-			continue
+	})
+	ticker := time.NewTicker(g.cfg.Batch.TickInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-g.ch:
+			if !ok {
+				batcher.FlushAll()
+				logger.Infof("GSE sender worker %d exiting", idx)
+				return
+			}
+			options := msg.GetOptions()
+			dataid, ok := options["dataid"].(int32)
+			if !ok {
+				logger.Errorf("GSE sender worker %d: missing or invalid dataid", idx)
+				logger.Debugf("GSE sender worker %d, drop msg %s ,options: %v", idx, msg.GetData(), options)
+				continue
+			}
+			data := msg.GetData()
+			if !json.Valid(data) {
+				logger.Errorf("GSE sender worker %d: invalid json data for dataid %d", idx, dataid)
+				logger.Debugf("GSE sender worker %d, drop msg %s", idx, data)
+				continue
+			}
+			batcher.Add(dataid, data)
+		case <-ticker.C:
+			batcher.FlushExpired()
 		}
 	}
-	logger.Infof("GSE sender worker %d exiting", idx)
 }
 
 func (g *GseSender) Push(msg sender.SenderMsg) {
@@ -0,0 +1,143 @@
+package payload
+
+import (
+	"encoding/json"
+	"time"
+	"zabbix-source/logger"
+)
+
+var (
+	defaultMaxRecords = 200
+	defaultMaxBytes   = 1 << 20
+	defaultMaxLatency = time.Second
+	// minMaxLatency max_latency 的下限 检查间隔为其一半 过小时 ticker 无法创建
+	minMaxLatency = 10 * time.Millisecond
+)
+
+// BatchConfig 批量发送配置
+// 任意一个条件满足即触发 flush
+type BatchConfig struct {
+	// MaxRecords 单个 payload 中最多包含的数据点数量
+	MaxRecords int `mapstructure:"max_records"`
+	// MaxBytes 单个 payload 中数据点的最大字节数
+	MaxBytes int `mapstructure:"max_bytes"`
+	// MaxLatency 数据点在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+}
+
+func (b *BatchConfig) SetDefaults() {
+	if b.MaxRecords <= 0 {
+		b.MaxRecords = defaultMaxRecords
+	}
+	if b.MaxBytes <= 0 {
+		b.MaxBytes = defaultMaxBytes
+	}
+	if b.MaxLatency <= 0 {
+		b.MaxLatency = defaultMaxLatency
+	}
+	if b.MaxLatency < minMaxLatency {
+		logger.Warnf("gse batch max_latency %s is too small, use %s", b.MaxLatency, minMaxLatency)
+		b.MaxLatency = minMaxLatency
+	}
+}
+
+// TickInterval 检查批次是否超时的间隔
+func (b *BatchConfig) TickInterval() time.Duration {
+	return b.MaxLatency / 2
+}
+
+// batch 同一个 dataid 下待发送的数据点
+type batch struct {
+	dataid  int32
+	points  []json.RawMessage
+	size    int
+	created time.Time
+}
+
+func (b *batch) add(point []byte) {
+	if len(b.points) == 0 {
+		b.created = time.Now()
+	}
+	b.points = append(b.points, json.RawMessage(point))
+	b.size += len(point)
+}
+
+func (b *batch) reset() {
+	b.points = b.points[:0]
+	b.size = 0
+}
+
+func (b *batch) empty() bool {
+	return len(b.points) == 0
+}
+
+// payload 将批次组装为 BlueKing 上报格式
+func (b *batch) payload() ([]byte, error) {
+	return json.Marshal(struct {
+		DataID int32             `json:"data_id"`
+		Data   []json.RawMessage `json:"data"`
+	}{
+		DataID: b.dataid,
+		Data:   b.points,
+	})
+}
+
+// FlushFunc 接收一个组装完成的 payload 以及其中的数据点数量
+type FlushFunc func(dataid int32, payload []byte, count int)
+
+// Batcher 按 dataid 聚合数据点 生成 GSE 实际接收的 payload
+// 不是并发安全的 每个使用方独立持有
+type Batcher struct {
+	cfg     BatchConfig
+	batches map[int32]*batch
+	flush   FlushFunc
+}
+
+func NewBatcher(cfg BatchConfig, flush FlushFunc) *Batcher {
+	return &Batcher{cfg: cfg, batches: make(map[int32]*batch), flush: flush}
+}
+
+// Add 加入一个 JSON 格式的数据点 达到数量或大小限制时立即 flush
+func (b *Batcher) Add(dataid int32, point []byte) {
+	bt, ok := b.batches[dataid]
+	if !ok {
+		bt = &batch{dataid: dataid, created: time.Now()}
+		b.batches[dataid] = bt
+	}
+	if !bt.empty() && bt.size+len(point) > b.cfg.MaxBytes {
+		b.flushBatch(bt)
+	}
+	bt.add(point)
+	if len(bt.points) >= b.cfg.MaxRecords || bt.size >= b.cfg.MaxBytes {
+		b.flushBatch(bt)
+	}
+}
+
+// FlushExpired flush 停留时间超过 max_latency 的批次
+func (b *Batcher) FlushExpired() {
+	for _, bt := range b.batches {
+		if !bt.empty() && time.Since(bt.created) >= b.cfg.MaxLatency {
+			b.flushBatch(bt)
+		}
+	}
+}
+
+// FlushAll flush 全部批次 用于退出前
+func (b *Batcher) FlushAll() {
+	for _, bt := range b.batches {
+		b.flushBatch(bt)
+	}
+}
+
+func (b *Batcher) flushBatch(bt *batch) {
+	if bt.empty() {
+		return
+	}
+	defer bt.reset()
+	data, err := bt.payload()
+	if err != nil {
+		logger.Errorf("failed to marshal gse payload for dataid %d: %v", bt.dataid, err)
+		return
+	}
+	b.flush(bt.dataid, data, len(bt.points))
+}
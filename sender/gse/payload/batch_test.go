@@ -0,0 +1,150 @@
+package payload
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+)
+
+type flushed struct {
+	dataid int32
+	points []string
+	count  int
+}
+
+// newTestBatcher 返回 Batcher 与记录全部 flush 结果的切片
+func newTestBatcher(t *testing.T, cfg BatchConfig) (*Batcher, *[]flushed) {
+	t.Helper()
+	var got []flushed
+	b := NewBatcher(cfg, func(dataid int32, data []byte, count int) {
+		var p struct {
+			DataID int32             `json:"data_id"`
+			Data   []json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &p); err != nil {
+			t.Fatalf("unmarshal payload: %v", err)
+		}
+		if p.DataID != dataid {
+			t.Errorf("payload data_id = %d, want %d", p.DataID, dataid)
+		}
+		f := flushed{dataid: dataid, count: count}
+		for _, d := range p.Data {
+			f.points = append(f.points, string(d))
+		}
+		got = append(got, f)
+	})
+	return b, &got
+}
+
+func checkFlushed(t *testing.T, got []flushed, want []flushed) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d payloads %v, want %d %v", len(got), got, len(want), want)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.dataid != w.dataid || g.count != len(w.points) || len(g.points) != len(w.points) {
+			t.Errorf("payload %d = %+v, want %+v", i, g, w)
+			continue
+		}
+		for j := range w.points {
+			if g.points[j] != w.points[j] {
+				t.Errorf("payload %d point %d = %s, want %s", i, j, g.points[j], w.points[j])
+			}
+		}
+	}
+}
+
+func TestBatcherGroupsByDataID(t *testing.T) {
+	b, got := newTestBatcher(t, BatchConfig{MaxRecords: 2, MaxBytes: 1 << 20, MaxLatency: time.Hour})
+	b.Add(1, []byte(`{"a":1}`))
+	b.Add(2, []byte(`{"b":1}`))
+	b.Add(1, []byte(`{"a":2}`))
+	// dataid 1 达到 max_records 立即 flush dataid 2 仍在等待
+	checkFlushed(t, *got, []flushed{{dataid: 1, points: []string{`{"a":1}`, `{"a":2}`}}})
+
+	b.Add(1, []byte(`{"a":3}`))
+	b.FlushAll()
+	if len(*got) != 3 {
+		t.Fatalf("got %d payloads after FlushAll, want 3", len(*got))
+	}
+	// FlushAll 按 map 顺序 flush 分别检查每个 dataid
+	rest := map[int32][]string{}
+	for _, f := range (*got)[1:] {
+		rest[f.dataid] = f.points
+	}
+	if len(rest[1]) != 1 || rest[1][0] != `{"a":3}` || len(rest[2]) != 1 || rest[2][0] != `{"b":1}` {
+		t.Errorf("FlushAll payloads = %v", rest)
+	}
+
+	// 已经 flush 的批次不会重复发送
+	b.FlushAll()
+	if len(*got) != 3 {
+		t.Errorf("got %d payloads after second FlushAll, want 3", len(*got))
+	}
+}
+
+func TestBatcherMaxBytes(t *testing.T) {
+	b, got := newTestBatcher(t, BatchConfig{MaxRecords: 100, MaxBytes: 16, MaxLatency: time.Hour})
+	b.Add(1, []byte(`{"a":1}`))
+	b.Add(1, []byte(`{"a":2}`))
+	// 加入后超过 max_bytes 时先 flush 已有的数据点
+	b.Add(1, []byte(`{"a":3}`))
+	checkFlushed(t, *got, []flushed{{dataid: 1, points: []string{`{"a":1}`, `{"a":2}`}}})
+
+	// 单个数据点超过 max_bytes 时单独发送
+	b.Add(1, []byte(`{"large":"xxxxxxxx"}`))
+	checkFlushed(t, *got, []flushed{
+		{dataid: 1, points: []string{`{"a":1}`, `{"a":2}`}},
+		{dataid: 1, points: []string{`{"a":3}`}},
+		{dataid: 1, points: []string{`{"large":"xxxxxxxx"}`}},
+	})
+}
+
+func TestBatcherFlushExpired(t *testing.T) {
+	b, got := newTestBatcher(t, BatchConfig{MaxRecords: 100, MaxBytes: 1 << 20, MaxLatency: 50 * time.Millisecond})
+	b.Add(1, []byte(`{"a":1}`))
+	b.FlushExpired()
+	if len(*got) != 0 {
+		t.Fatalf("flushed %v before max_latency", *got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	b.Add(2, []byte(`{"b":1}`))
+	b.FlushExpired()
+	checkFlushed(t, *got, []flushed{{dataid: 1, points: []string{`{"a":1}`}}})
+
+	// 批次在清空后重新计时
+	b.Add(1, []byte(`{"a":2}`))
+	b.FlushExpired()
+	if len(*got) != 1 {
+		t.Errorf("flushed %v right after the batch was refilled", *got)
+	}
+}
+
+func TestBatchConfigSetDefaults(t *testing.T) {
+	logger.Init(config.LoggerConfig{OutputPath: t.TempDir()})
+	tests := []struct {
+		in, want time.Duration
+	}{
+		{0, defaultMaxLatency},
+		{-time.Second, defaultMaxLatency},
+		{time.Millisecond, minMaxLatency},
+		{minMaxLatency, minMaxLatency},
+		{time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		c := BatchConfig{MaxLatency: tt.in}
+		c.SetDefaults()
+		if c.MaxLatency != tt.want {
+			t.Errorf("SetDefaults max_latency %s = %s, want %s", tt.in, c.MaxLatency, tt.want)
+		}
+		if c.TickInterval() <= 0 {
+			t.Errorf("SetDefaults max_latency %s tick interval %s", tt.in, c.TickInterval())
+		}
+		if c.MaxRecords != defaultMaxRecords || c.MaxBytes != defaultMaxBytes {
+			t.Errorf("SetDefaults = %+v", c)
+		}
+	}
+}
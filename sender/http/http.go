@@ -0,0 +1,393 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+)
+
+var (
+	worker            = 2
+	buffer            = 500
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRecords = 500
+	defaultMaxLatency = time.Second
+	defaultMaxRetries = 5
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+
+	// PayloadData 发送格式化后的消息数据
+	PayloadData = "data"
+	// PayloadRecord 发送经过处理的完整记录
+	PayloadRecord = "record"
+)
+
+func init() {
+	if err := sender.RegisterSender("http", NewHTTPSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type RetryConfig struct {
+	// MaxRetries 最大重试次数 为负数时不重试
+	MaxRetries int `mapstructure:"max_retries"`
+	// Backoff 首次重试的等待时间 之后按指数增长
+	Backoff time.Duration `mapstructure:"backoff"`
+	// MaxBackoff 重试等待时间上限
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+type HTTPConfig struct {
+	// URLs 接收地址 请求失败时依次尝试下一个地址
+	URLs []string `mapstructure:"urls"`
+	// Format 请求体格式 json ndjson
+	Format string `mapstructure:"format"`
+	// Payload 每条记录的内容 data record
+	Payload     string            `mapstructure:"payload"`
+	Headers     map[string]string `mapstructure:"headers"`
+	BearerToken string            `mapstructure:"bearer_token"`
+	Username    string            `mapstructure:"username"`
+	Password    string            `mapstructure:"password"`
+	Gzip        bool              `mapstructure:"gzip"`
+	Timeout     time.Duration     `mapstructure:"timeout"`
+	Worker      int               `mapstructure:"worker"`
+	Buffer      int               `mapstructure:"buffer"`
+	// MaxRecords 单个请求中最多包含的记录数
+	MaxRecords int `mapstructure:"max_records"`
+	// MaxLatency 记录在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	Retry      RetryConfig   `mapstructure:"retry"`
+	// DeadLetterPath 永久失败的记录以 NDJSON 写入该文件 为空时丢弃
+	DeadLetterPath string `mapstructure:"dead_letter_path"`
+}
+
+// HTTPSender 将记录批量 POST 到 HTTP 接口
+type HTTPSender struct {
+	cfg    HTTPConfig
+	wg     sync.WaitGroup
+	ch     chan sender.SenderMsg
+	client *nethttp.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	dlMu       sync.Mutex
+	deadLetter *os.File
+}
+
+func NewHTTPSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := HTTPConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode http sender config: %v", err)
+		return nil
+	}
+	if len(c.URLs) == 0 {
+		logger.Errorf("http sender urls is required")
+		return nil
+	}
+	if c.Format == "" {
+		c.Format = FormatJSON
+	}
+	if c.Format != FormatJSON && c.Format != FormatNDJSON {
+		logger.Errorf("http sender unknown format %s", c.Format)
+		return nil
+	}
+	if c.Payload == "" {
+		c.Payload = PayloadRecord
+	}
+	if c.Payload != PayloadRecord && c.Payload != PayloadData {
+		logger.Errorf("http sender unknown payload %s", c.Payload)
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Worker <= 0 {
+		c.Worker = worker
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.MaxRecords <= 0 {
+		c.MaxRecords = defaultMaxRecords
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.Retry.MaxRetries < 0 {
+		c.Retry.MaxRetries = 0
+	} else if c.Retry.MaxRetries == 0 {
+		c.Retry.MaxRetries = defaultMaxRetries
+	}
+	if c.Retry.Backoff <= 0 {
+		c.Retry.Backoff = defaultBackoff
+	}
+	if c.Retry.MaxBackoff <= 0 {
+		c.Retry.MaxBackoff = defaultMaxBackoff
+	}
+	return &HTTPSender{
+		cfg:    c,
+		wg:     sync.WaitGroup{},
+		ch:     make(chan sender.SenderMsg, c.Buffer),
+		client: &nethttp.Client{Timeout: c.Timeout},
+	}
+}
+
+func (h *HTTPSender) Name() string {
+	return "http"
+}
+
+func (h *HTTPSender) Run() error {
+	if h.cfg.DeadLetterPath != "" {
+		if err := os.MkdirAll(filepath.Dir(h.cfg.DeadLetterPath), 0755); err != nil {
+			return fmt.Errorf("failed to create dead letter directory: %v", err)
+		}
+		f, err := os.OpenFile(h.cfg.DeadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open dead letter file: %v", err)
+		}
+		h.deadLetter = f
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.wg.Add(h.cfg.Worker)
+	for idx := 0; idx < h.cfg.Worker; idx++ {
+		go h.consume(idx)
+	}
+	return nil
+}
+
+func (h *HTTPSender) consume(idx int) {
+	defer h.wg.Done()
+	var batch [][]byte
+	ticker := time.NewTicker(h.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-h.ch:
+			if !ok {
+				h.flush(idx, batch)
+				logger.Infof("http sender worker %d exiting", idx)
+				return
+			}
+			item, err := h.encode(msg)
+			if err != nil {
+				logger.Errorf("http sender worker %d: %v", idx, err)
+				continue
+			}
+			batch = append(batch, item)
+			if len(batch) >= h.cfg.MaxRecords {
+				h.flush(idx, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			h.flush(idx, batch)
+			batch = nil
+		}
+	}
+}
+
+// encode 返回单条记录的 JSON
+func (h *HTTPSender) encode(msg sender.SenderMsg) ([]byte, error) {
+	if h.cfg.Payload == PayloadData {
+		return msg.GetData(), nil
+	}
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok {
+		return msg.GetData(), nil
+	}
+	data, err := rec.ExportJSON()
+	if err != nil {
+		return nil, fmt.Errorf("marshal record failed: %w", err)
+	}
+	return data, nil
+}
+
+// body 按配置的格式组装请求体
+func (h *HTTPSender) body(batch [][]byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gz *gzip.Writer
+	if h.cfg.Gzip {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+	h.writeBody(w, batch)
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody 按 format 写入未压缩的请求体
+func (h *HTTPSender) writeBody(w io.Writer, batch [][]byte) {
+	if h.cfg.Format == FormatJSON {
+		w.Write([]byte{'['})
+	}
+	for i, item := range batch {
+		if i > 0 {
+			if h.cfg.Format == FormatJSON {
+				w.Write([]byte{','})
+			} else {
+				w.Write([]byte{'\n'})
+			}
+		}
+		w.Write(item)
+	}
+	if h.cfg.Format == FormatJSON {
+		w.Write([]byte{']'})
+	} else {
+		w.Write([]byte{'\n'})
+	}
+}
+
+// Format 返回只包含该消息的请求体 用于 dry-run 不压缩
+func (h *HTTPSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	item, err := h.encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	h.writeBody(buf, [][]byte{item})
+	return buf.Bytes(), nil
+}
+
+func (h *HTTPSender) flush(idx int, batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := h.body(batch)
+	if err != nil {
+		logger.Errorf("http sender worker %d: build request body failed: %v", idx, err)
+		h.writeDeadLetter(batch)
+		return
+	}
+	backoff := h.cfg.Retry.Backoff
+	for attempt := 0; ; attempt++ {
+		url := h.cfg.URLs[attempt%len(h.cfg.URLs)]
+		retryAfter, retryable, err := h.post(url, body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= h.cfg.Retry.MaxRetries {
+			logger.Errorf("http sender worker %d: give up %d records after %d attempts: %v", idx, len(batch), attempt+1, err)
+			h.writeDeadLetter(batch)
+			return
+		}
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		logger.Warnf("http sender worker %d: post to %s failed, retry in %s: %v", idx, url, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-h.ctx.Done():
+			logger.Errorf("http sender worker %d: stopped while retrying %d records", idx, len(batch))
+			h.writeDeadLetter(batch)
+			return
+		}
+		backoff *= 2
+		if backoff > h.cfg.Retry.MaxBackoff {
+			backoff = h.cfg.Retry.MaxBackoff
+		}
+	}
+}
+
+// post 发送一次请求
+// 返回服务端要求的重试等待时间 以及失败是否可以重试
+func (h *HTTPSender) post(url string, body []byte) (time.Duration, bool, error) {
+	req, err := nethttp.NewRequest(nethttp.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	if h.cfg.Format == FormatJSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if h.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.BearerToken)
+	} else if h.cfg.Username != "" {
+		req.SetBasicAuth(h.cfg.Username, h.cfg.Password)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode == nethttp.StatusTooManyRequests || resp.StatusCode >= 500 {
+		var retryAfter time.Duration
+		if sec, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && sec > 0 {
+			retryAfter = time.Duration(sec) * time.Second
+		}
+		return retryAfter, true, err
+	}
+	return 0, false, err
+}
+
+// writeDeadLetter 将失败的记录以 NDJSON 追加到死信文件
+func (h *HTTPSender) writeDeadLetter(batch [][]byte) {
+	if h.deadLetter == nil {
+		return
+	}
+	h.dlMu.Lock()
+	defer h.dlMu.Unlock()
+	for _, item := range batch {
+		if _, err := h.deadLetter.Write(item); err != nil {
+			logger.Errorf("http sender failed to write dead letter: %v", err)
+			return
+		}
+		if _, err := h.deadLetter.Write([]byte{'\n'}); err != nil {
+			logger.Errorf("http sender failed to write dead letter: %v", err)
+			return
+		}
+	}
+}
+
+func (h *HTTPSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("http sender push failed: channel closed")
+		}
+	}()
+	h.ch <- msg
+}
+
+func (h *HTTPSender) Stop() {
+	close(h.ch)
+	// 停止时不再等待重试 未发送成功的记录直接写入死信文件
+	h.cancel()
+	h.wg.Wait()
+	if h.deadLetter != nil {
+		h.deadLetter.Close()
+	}
+	logger.Infof("http sender stopped")
+}
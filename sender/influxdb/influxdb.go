@@ -0,0 +1,345 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	buffer            = 500
+	defaultTimeout    = 10 * time.Second
+	defaultMaxLines   = 1000
+	defaultMaxLatency = time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	defaultPacketSize = 1400
+)
+
+const (
+	TargetHTTP = "http"
+	TargetUDP  = "udp"
+	TargetFile = "file"
+)
+
+func init() {
+	if err := sender.RegisterSender("influxdb", NewInfluxSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type InfluxConfig struct {
+	// Target 写入目标 http udp file
+	Target string `mapstructure:"target"`
+	// URL InfluxDB 地址 例如 http://127.0.0.1:8086
+	URL    string `mapstructure:"url"`
+	Org    string `mapstructure:"org"`
+	Bucket string `mapstructure:"bucket"`
+	Token  string `mapstructure:"token"`
+	// Addr UDP 目标地址
+	Addr string `mapstructure:"addr"`
+	// PacketSize 单个 UDP 包的最大字节数
+	PacketSize int `mapstructure:"packet_size"`
+	// Path 文件目标路径
+	Path    string        `mapstructure:"path"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Buffer  int           `mapstructure:"buffer"`
+	// MaxLines 单次写入最多包含的行数
+	MaxLines int `mapstructure:"max_lines"`
+	// MaxLatency 数据在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	MaxRetries int           `mapstructure:"max_retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	// Mapping 默认映射规则
+	Mapping Mapping `mapstructure:"mapping"`
+}
+
+// InfluxSender 将记录以 line protocol 写入 InfluxDB
+type InfluxSender struct {
+	cfg  InfluxConfig
+	wg   sync.WaitGroup
+	ch   chan string
+	send func([]byte) (bool, error)
+	// ctx 在 Stop 时取消 用于中断重试等待
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	client  *http.Client
+	udpConn net.Conn
+	file    *os.File
+
+	// mappings 按路由规则名称缓存合并后的映射规则
+	mu       sync.Mutex
+	mappings map[string]*Mapping
+}
+
+func NewInfluxSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := InfluxConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode influxdb sender config: %v", err)
+		return nil
+	}
+	if c.Target == "" {
+		c.Target = TargetHTTP
+	}
+	switch c.Target {
+	case TargetHTTP:
+		if c.URL == "" || c.Bucket == "" {
+			logger.Errorf("influxdb sender url and bucket are required for http target")
+			return nil
+		}
+	case TargetUDP:
+		if c.Addr == "" {
+			logger.Errorf("influxdb sender addr is required for udp target")
+			return nil
+		}
+	case TargetFile:
+		if c.Path == "" {
+			logger.Errorf("influxdb sender path is required for file target")
+			return nil
+		}
+	default:
+		logger.Errorf("influxdb sender unknown target %s", c.Target)
+		return nil
+	}
+	if c.PacketSize <= 0 {
+		c.PacketSize = defaultPacketSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.MaxLines <= 0 {
+		c.MaxLines = defaultMaxLines
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	c.Mapping.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &InfluxSender{
+		cfg:      c,
+		wg:       sync.WaitGroup{},
+		ch:       make(chan string, c.Buffer),
+		ctx:      ctx,
+		cancel:   cancel,
+		mappings: make(map[string]*Mapping),
+	}
+}
+
+func (s *InfluxSender) Name() string {
+	return "influxdb"
+}
+
+func (s *InfluxSender) Run() error {
+	switch s.cfg.Target {
+	case TargetHTTP:
+		s.client = &http.Client{Timeout: s.cfg.Timeout}
+		s.send = s.sendHTTP
+	case TargetUDP:
+		conn, err := net.Dial("udp", s.cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to dial influxdb udp %s: %v", s.cfg.Addr, err)
+		}
+		s.udpConn = conn
+		s.send = s.sendUDP
+	case TargetFile:
+		if err := os.MkdirAll(filepath.Dir(s.cfg.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", s.cfg.Path, err)
+		}
+		f, err := os.OpenFile(s.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", s.cfg.Path, err)
+		}
+		s.file = f
+		s.send = s.sendFile
+	}
+	s.wg.Add(1)
+	go s.consume()
+	return nil
+}
+
+// mapping 返回路由规则对应的映射规则
+// 路由规则 options.influxdb 中的配置覆盖 Sender 的默认配置
+func (s *InfluxSender) mapping(options map[string]interface{}) *Mapping {
+	route, _ := options["route"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.mappings[route]; ok {
+		return m
+	}
+	m := s.cfg.Mapping
+	if raw, ok := options["influxdb"]; ok {
+		o := Mapping{}
+		if err := mapstructure.Decode(raw, &o); err != nil {
+			logger.Errorf("influxdb sender: invalid mapping for route %s: %v", route, err)
+		} else {
+			m = m.merge(o)
+		}
+	}
+	s.mappings[route] = &m
+	return &m
+}
+
+func (s *InfluxSender) consume() {
+	defer s.wg.Done()
+	var lines []string
+	ticker := time.NewTicker(s.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-s.ch:
+			if !ok {
+				s.flush(lines)
+				logger.Infof("influxdb sender exiting")
+				return
+			}
+			lines = append(lines, line)
+			if len(lines) >= s.cfg.MaxLines {
+				s.flush(lines)
+				lines = nil
+			}
+		case <-ticker.C:
+			s.flush(lines)
+			lines = nil
+		}
+	}
+}
+
+func (s *InfluxSender) flush(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	backoff := s.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.send(body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= s.cfg.MaxRetries {
+			logger.Errorf("influxdb sender: drop %d lines after %d attempts: %v", len(lines), attempt+1, err)
+			return
+		}
+		logger.Warnf("influxdb sender: write failed, retry in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			logger.Errorf("influxdb sender: stopped while retrying, drop %d lines", len(lines))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (s *InfluxSender) sendHTTP(body []byte) (bool, error) {
+	query := url.Values{}
+	query.Set("org", s.cfg.Org)
+	query.Set("bucket", s.cfg.Bucket)
+	query.Set("precision", "ns")
+	endpoint := strings.TrimRight(s.cfg.URL, "/") + "/api/v2/write?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// sendUDP 按行拆分为不超过 PacketSize 的 UDP 包
+func (s *InfluxSender) sendUDP(body []byte) (bool, error) {
+	for len(body) > 0 {
+		end := len(body)
+		if end > s.cfg.PacketSize {
+			end = bytes.LastIndexByte(body[:s.cfg.PacketSize], '\n') + 1
+			if end <= 0 {
+				// 单行超过包大小 只能整行发送
+				end = bytes.IndexByte(body, '\n') + 1
+			}
+		}
+		if _, err := s.udpConn.Write(body[:end]); err != nil {
+			return false, err
+		}
+		body = body[end:]
+	}
+	return false, nil
+}
+
+func (s *InfluxSender) sendFile(body []byte) (bool, error) {
+	_, err := s.file.Write(body)
+	return false, err
+}
+
+// Format 返回记录对应的 line protocol 用于 dry-run
+func (s *InfluxSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	options := msg.GetOptions()
+	rec, ok := options["record"].(*record.Record)
+	if !ok {
+		return nil, nil
+	}
+	return []byte(s.mapping(options).Line(rec)), nil
+}
+
+func (s *InfluxSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("influxdb sender push failed: channel closed")
+		}
+	}()
+	options := msg.GetOptions()
+	rec, ok := options["record"].(*record.Record)
+	if !ok {
+		return
+	}
+	s.ch <- s.mapping(options).Line(rec)
+}
+
+func (s *InfluxSender) Stop() {
+	close(s.ch)
+	// 停止时不再等待重试
+	s.cancel()
+	s.wg.Wait()
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	logger.Infof("influxdb sender stopped")
+}
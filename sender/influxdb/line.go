@@ -0,0 +1,162 @@
+package influxdb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"zabbix-source/record"
+)
+
+// line protocol 以换行分隔记录 measurement 与 tag 中无法转义换行 替换为空格
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+)
+
+// Mapping 记录到 line protocol 的映射规则
+// 可在 Sender 配置中设置默认值 也可在路由规则 options.influxdb 中覆盖
+type Mapping struct {
+	// Measurement measurement 名称模板 支持 {metric} {host} {type} 占位符
+	Measurement string `mapstructure:"measurement"`
+	// EventMeasurement 事件记录使用的 measurement
+	EventMeasurement string `mapstructure:"event_measurement"`
+	// Tags 作为 tag 的维度名称 为空时使用全部维度
+	Tags []string `mapstructure:"tags"`
+	// Field history 记录值使用的 field 名称
+	Field string `mapstructure:"field"`
+}
+
+func (m *Mapping) setDefaults() {
+	if m.Measurement == "" {
+		m.Measurement = "{metric}"
+	}
+	if m.EventMeasurement == "" {
+		m.EventMeasurement = "zabbix_events"
+	}
+	if m.Field == "" {
+		m.Field = "value"
+	}
+}
+
+// merge 使用 o 中非空的字段覆盖 m
+func (m Mapping) merge(o Mapping) Mapping {
+	if o.Measurement != "" {
+		m.Measurement = o.Measurement
+	}
+	if o.EventMeasurement != "" {
+		m.EventMeasurement = o.EventMeasurement
+	}
+	if len(o.Tags) > 0 {
+		m.Tags = o.Tags
+	}
+	if o.Field != "" {
+		m.Field = o.Field
+	}
+	return m
+}
+
+func (m *Mapping) measurement(rec *record.Record) string {
+	if rec.Type == record.TypeEvents {
+		return m.EventMeasurement
+	}
+	return strings.NewReplacer(
+		"{metric}", rec.MetricName(),
+		"{host}", rec.HostName(),
+		"{type}", string(rec.Type),
+	).Replace(m.Measurement)
+}
+
+func (m *Mapping) tags(rec *record.Record) map[string]string {
+	dims := rec.Dims()
+	if len(m.Tags) == 0 {
+		return dims
+	}
+	tags := make(map[string]string, len(m.Tags))
+	for _, name := range m.Tags {
+		if v, ok := dims[name]; ok {
+			tags[name] = v
+		}
+	}
+	return tags
+}
+
+func floatField(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func stringField(s string) string {
+	return `"` + stringEscaper.Replace(s) + `"`
+}
+
+// fields 返回记录的 field 集合 值已按 line protocol 格式化
+func (m *Mapping) fields(rec *record.Record) map[string]string {
+	switch {
+	case rec.Type == record.TypeTrends:
+		return map[string]string{
+			"min":   floatField(rec.Min),
+			"avg":   floatField(rec.Avg),
+			"max":   floatField(rec.Max),
+			"count": strconv.FormatInt(rec.Count, 10) + "i",
+		}
+	case rec.Type == record.TypeEvents:
+		return map[string]string{
+			"name":     stringField(rec.Name),
+			"severity": strconv.Itoa(rec.Severity) + "i",
+			"problem":  strconv.FormatBool(rec.IsProblem()),
+		}
+	case rec.ValueType == record.ValueTypeUint:
+		if _, err := strconv.ParseInt(string(rec.Value), 10, 64); err == nil {
+			return map[string]string{m.Field: string(rec.Value) + "i"}
+		}
+		v, _ := rec.NumericValue()
+		return map[string]string{m.Field: floatField(v)}
+	case rec.ValueType == record.ValueTypeFloat:
+		v, _ := rec.NumericValue()
+		return map[string]string{m.Field: floatField(v)}
+	default:
+		return map[string]string{m.Field: stringField(rec.StringValue())}
+	}
+}
+
+// Line 将记录按映射规则转换为一行 line protocol 时间精度为纳秒
+func (m *Mapping) Line(rec *record.Record) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(m.measurement(rec)))
+
+	tags := m.tags(rec)
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tags[k]))
+	}
+
+	fields := m.fields(rec)
+	keys = keys[:0]
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(fields[k])
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(rec.TimestampNs(), 10))
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package influxdb
+
+import (
+	"testing"
+	"zabbix-source/record"
+)
+
+func TestLine(t *testing.T) {
+	host := &record.Host{Host: "web01", Name: "Web 01"}
+	tests := []struct {
+		name    string
+		mapping Mapping
+		rec     *record.Record
+		want    string
+	}{
+		{
+			name: "float",
+			rec:  &record.Record{Type: record.TypeHistory, Host: host, ItemID: 1, Metric: "cpu", Clock: 1700000000, Ns: 123, Value: []byte("1.5")},
+			want: `cpu,host=web01,host_name=Web\ 01,itemid=1 value=1.5 1700000000000000123`,
+		},
+		{
+			name: "uint",
+			rec:  &record.Record{Type: record.TypeHistory, ItemID: 2, Clock: 1, ValueType: record.ValueTypeUint, Value: []byte("42")},
+			want: `item_2,itemid=2 value=42i 1000000000`,
+		},
+		{
+			name: "uint beyond int64",
+			rec:  &record.Record{Type: record.TypeHistory, ItemID: 2, Clock: 1, ValueType: record.ValueTypeUint, Value: []byte("18446744073709551615")},
+			want: `item_2,itemid=2 value=18446744073709552000 1000000000`,
+		},
+		{
+			name:    "string field escaping",
+			mapping: Mapping{Field: "text"},
+			rec:     &record.Record{Type: record.TypeHistory, ItemID: 3, Clock: 1, ValueType: record.ValueTypeText, Value: []byte(`"say \"hi\" C:\\dir\nnext\r"`)},
+			want:    `item_3,itemid=3 text="say \"hi\" C:\\dir\nnext\r" 1000000000`,
+		},
+		{
+			name: "measurement and tag escaping",
+			rec: &record.Record{Type: record.TypeHistory, Metric: "a,b c\nd", Clock: 1, Value: []byte("1"),
+				Dimensions: map[string]string{"k=1 x": "v,1=2 3\r\n", "empty": ""}},
+			want: `a\,b\ c\ d,k\=1\ x=v\,1\=2\ 3\ \  value=1 1000000000`,
+		},
+		{
+			name:    "measurement template and selected tags",
+			mapping: Mapping{Measurement: "zabbix_{type}_{metric}", Tags: []string{"host", "missing"}},
+			rec:     &record.Record{Type: record.TypeHistory, Host: host, ItemID: 1, ItemKey: "system.cpu.util[,idle]", Clock: 1, Value: []byte("99")},
+			want:    `zabbix_history_system_cpu_util_idle,host=web01 value=99 1000000000`,
+		},
+		{
+			name: "trends",
+			rec:  &record.Record{Type: record.TypeTrends, ItemID: 4, Metric: "load", Clock: 3600, Count: 60, Min: 0.5, Avg: 1.25, Max: 3},
+			want: `load,itemid=4 avg=1.25,count=60i,max=3,min=0.5 3600000000000`,
+		},
+		{
+			name: "problem event",
+			rec: &record.Record{Type: record.TypeEvents, EventID: 10, Name: `Disk "/" is full`, Severity: 4, Clock: 1, Value: []byte("1"),
+				Hosts: []record.Host{{Host: "db01", Name: "DB"}}},
+			want: `zabbix_events,eventid=10,host=db01,host_name=DB name="Disk \"/\" is full",problem=true,severity=4i 1000000000`,
+		},
+		{
+			name:    "recovery event",
+			mapping: Mapping{EventMeasurement: "alerts"},
+			rec:     &record.Record{Type: record.TypeEvents, EventID: 11, PEventID: 10, Name: "ok", Clock: 1, Value: []byte("0")},
+			want:    `alerts,eventid=11 name="ok",problem=false,severity=0i 1000000000`,
+		},
+	}
+	for _, tt := range tests {
+		m := tt.mapping
+		m.setDefaults()
+		if got := m.Line(tt.rec); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMappingMerge(t *testing.T) {
+	base := Mapping{Measurement: "{metric}", EventMeasurement: "events", Tags: []string{"host"}, Field: "value"}
+	got := base.merge(Mapping{Measurement: "m", Tags: []string{"itemid"}})
+	if got.Measurement != "m" || got.EventMeasurement != "events" || len(got.Tags) != 1 || got.Tags[0] != "itemid" || got.Field != "value" {
+		t.Errorf("merge = %+v", got)
+	}
+	if base.Measurement != "{metric}" || base.Tags[0] != "host" {
+		t.Errorf("merge modified the base mapping: %+v", base)
+	}
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	kafkaCompressionMap = map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+)
+
+const (
+	// KeyHost 以主机名作为消息 key 同一主机的数据进入同一分区
+	KeyHost = "host"
+	// KeyItemID 以 itemid 作为消息 key 同一监控项的数据进入同一分区 事件使用 eventid
+	KeyItemID = "itemid"
+
+	// FormatRecord 发送经过处理的完整记录
+	FormatRecord = "record"
+	// FormatData 发送格式化后的消息数据 与发送给 GSE 的数据点一致
+	FormatData = "data"
+)
+
+func init() {
+	if err := sender.RegisterSender("kafka", NewKafkaSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type KafkaConfig struct {
+	Addr     []string `mapstructure:"addr"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	Version  string   `mapstructure:"version"`
+	// Topic 默认 topic 路由规则 options 中的 topic 优先
+	Topic string `mapstructure:"topic"`
+	// Key 消息 key 的来源 host itemid 为空时不设置 key
+	Key string `mapstructure:"key"`
+	// Format 消息内容 record data
+	Format string `mapstructure:"format"`
+	// Compression 压缩方式 none gzip snappy lz4 zstd
+	Compression string `mapstructure:"compression"`
+	// Idempotent 是否开启幂等生产者
+	Idempotent bool `mapstructure:"idempotent"`
+}
+
+// KafkaSender 将记录重新发布到 Kafka
+type KafkaSender struct {
+	cfg      KafkaConfig
+	wg       sync.WaitGroup
+	conf     *sarama.Config
+	producer sarama.AsyncProducer
+}
+
+func NewKafkaSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := KafkaConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode kafka sender config: %v", err)
+		return nil
+	}
+	if len(c.Addr) == 0 {
+		logger.Errorf("kafka sender addr is required")
+		return nil
+	}
+	if c.Key != "" && c.Key != KeyHost && c.Key != KeyItemID {
+		logger.Errorf("kafka sender unknown key %s", c.Key)
+		return nil
+	}
+	if c.Format == "" {
+		c.Format = FormatRecord
+	}
+	if c.Format != FormatRecord && c.Format != FormatData {
+		logger.Errorf("kafka sender unknown format %s", c.Format)
+		return nil
+	}
+
+	saramaConf := sarama.NewConfig()
+	if c.Version != "" {
+		if v, err := sarama.ParseKafkaVersion(c.Version); err == nil {
+			saramaConf.Version = v
+		}
+	}
+	if c.Username != "" && c.Password != "" {
+		saramaConf.Net.SASL.Enable = true
+		saramaConf.Net.SASL.User = c.Username
+		saramaConf.Net.SASL.Password = c.Password
+	}
+	if c.Compression != "" {
+		codec, ok := kafkaCompressionMap[c.Compression]
+		if !ok {
+			logger.Errorf("kafka sender unknown compression %s", c.Compression)
+			return nil
+		}
+		saramaConf.Producer.Compression = codec
+	}
+	if c.Idempotent {
+		// 幂等生产者要求 acks=all 且同一连接上只有一个未完成的请求
+		saramaConf.Producer.Idempotent = true
+		saramaConf.Producer.RequiredAcks = sarama.WaitForAll
+		saramaConf.Net.MaxOpenRequests = 1
+		if !saramaConf.Version.IsAtLeast(sarama.V0_11_0_0) {
+			saramaConf.Version = sarama.V0_11_0_0
+		}
+	}
+	saramaConf.Producer.Return.Successes = false
+	saramaConf.Producer.Return.Errors = true
+	if err := saramaConf.Validate(); err != nil {
+		logger.Errorf("invalid kafka sender config: %v", err)
+		return nil
+	}
+	return &KafkaSender{
+		cfg:  c,
+		wg:   sync.WaitGroup{},
+		conf: saramaConf,
+	}
+}
+
+func (k *KafkaSender) Name() string {
+	return "kafka"
+}
+
+func (k *KafkaSender) Run() error {
+	producer, err := sarama.NewAsyncProducer(k.cfg.Addr, k.conf)
+	if err != nil {
+		return fmt.Errorf("failed to create kafka producer: %v", err)
+	}
+	k.producer = producer
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		for err := range producer.Errors() {
+			logger.Errorf("kafka sender failed to produce to topic %s: %v", err.Msg.Topic, err.Err)
+		}
+	}()
+	return nil
+}
+
+// message 将消息转换为 Kafka 消息 无法确定 topic 时返回错误
+func (k *KafkaSender) message(msg sender.SenderMsg) (*sarama.ProducerMessage, error) {
+	options := msg.GetOptions()
+	topic := k.cfg.Topic
+	if v, ok := options["topic"].(string); ok && v != "" {
+		topic = v
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("no topic for route %v", options["route"])
+	}
+	rec, _ := options["record"].(*record.Record)
+	value := msg.GetData()
+	if k.cfg.Format == FormatRecord && rec != nil {
+		data, err := rec.ExportJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal record: %w", err)
+		}
+		value = data
+	}
+	pm := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(value),
+	}
+	if rec != nil {
+		switch k.cfg.Key {
+		case KeyHost:
+			pm.Key = sarama.StringEncoder(rec.HostName())
+		case KeyItemID:
+			// 事件没有 itemid 使用 eventid 避免全部进入同一分区
+			id := rec.ItemID
+			if rec.Type == record.TypeEvents {
+				id = rec.EventID
+			}
+			pm.Key = sarama.StringEncoder(strconv.FormatUint(id, 10))
+		}
+	}
+	return pm, nil
+}
+
+// Format 返回消息的 topic key 与内容 用于 dry-run
+func (k *KafkaSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	pm, err := k.message(msg)
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if pm.Key != nil {
+		key = string(pm.Key.(sarama.StringEncoder))
+	}
+	return fmt.Appendf(nil, "topic=%s key=%s %s", pm.Topic, key, pm.Value.(sarama.ByteEncoder)), nil
+}
+
+func (k *KafkaSender) Push(msg sender.SenderMsg) {
+	pm, err := k.message(msg)
+	if err != nil {
+		logger.Errorf("kafka sender: %v", err)
+		return
+	}
+	k.producer.Input() <- pm
+}
+
+func (k *KafkaSender) Stop() {
+	// AsyncClose 会在发送完缓存的消息后关闭 Errors chan
+	k.producer.AsyncClose()
+	k.wg.Wait()
+	logger.Infof("kafka sender stopped")
+}
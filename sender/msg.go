@@ -0,0 +1,43 @@
+package sender
+
+// Msg SenderMsg 的默认实现
+type Msg struct {
+	data    []byte
+	options map[string]interface{}
+	senders []string
+}
+
+// NewMsg 创建消息
+// options 中 "record" 为原始记录 *record.Record 供需要结构化数据的 Sender 使用
+// Sender 只能读取 record 不能修改
+func NewMsg(data []byte, options map[string]interface{}, senders []string) *Msg {
+	return &Msg{
+		data:    data,
+		options: options,
+		senders: senders,
+	}
+}
+
+func (m *Msg) GetData() []byte {
+	return m.data
+}
+
+func (m *Msg) GetOptions() map[string]interface{} {
+	return m.options
+}
+
+func (m *Msg) GetSenders() []string {
+	return m.senders
+}
+
+// copyMsg 为单个 Sender 复制一份消息
+// 数据与补充信息各自独立 Sender 之间互不影响
+func copyMsg(msg SenderMsg, name string) SenderMsg {
+	data := make([]byte, len(msg.GetData()))
+	copy(data, msg.GetData())
+	options := make(map[string]interface{}, len(msg.GetOptions()))
+	for k, v := range msg.GetOptions() {
+		options[k] = v
+	}
+	return NewMsg(data, options, []string{name})
+}
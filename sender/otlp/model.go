@@ -0,0 +1,233 @@
+package otlp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"zabbix-source/record"
+)
+
+// OTLP/HTTP JSON 编码的数据结构
+// 只定义了本 Sender 用到的字段 int64 按协议要求编码为字符串
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type numberDataPoint struct {
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	AsDouble     *float64   `json:"asDouble,omitempty"`
+	AsInt        string     `json:"asInt,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type metric struct {
+	Name  string `json:"name"`
+	Gauge gauge  `json:"gauge"`
+}
+
+type scopeMetrics struct {
+	Scope   scope     `json:"scope"`
+	Metrics []*metric `json:"metrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type metricsRequest struct {
+	ResourceMetrics []*resourceMetrics `json:"resourceMetrics"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano,omitempty"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      scope        `json:"scope"`
+	LogRecords []*logRecord `json:"logRecords"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type logsRequest struct {
+	ResourceLogs []*resourceLogs `json:"resourceLogs"`
+}
+
+// problemSeverity Zabbix 问题严重级别到 OTel SeverityNumber 的映射
+var problemSeverity = []struct {
+	number int
+	text   string
+}{
+	{9, "Not classified"},
+	{9, "Information"},
+	{13, "Warning"},
+	{17, "Average"},
+	{18, "High"},
+	{21, "Disaster"},
+}
+
+func stringAttr(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func boolAttr(key string, value bool) keyValue {
+	return keyValue{Key: key, Value: anyValue{BoolValue: &value}}
+}
+
+// resourceDims 基础维度到 resource 属性名的映射
+var resourceDims = map[string]string{
+	"host":      "host.name",
+	"host_name": "zabbix.host.name",
+	"ip":        "host.ip",
+}
+
+// recordDims 基础维度到记录属性名的映射 eventid 由 logOf 单独输出
+var recordDims = map[string]string{
+	"itemid":  "zabbix.itemid",
+	"groups":  "zabbix.groups",
+	"eventid": "",
+}
+
+// resourceAttrs 以主机作为 resource
+// 属性来自 rec.Dims() 已删除的维度不输出
+func resourceAttrs(rec *record.Record) []keyValue {
+	dims := rec.Dims()
+	var attrs []keyValue
+	for _, k := range []string{"host", "host_name", "ip"} {
+		if v, ok := dims[k]; ok {
+			attrs = append(attrs, stringAttr(resourceDims[k], v))
+		}
+	}
+	return attrs
+}
+
+// attrsKey 相同 resource 属性的记录合并到同一个 resource
+func attrsKey(attrs []keyValue) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		b.WriteString(a.Key)
+		b.WriteByte('=')
+		b.WriteString(*a.Value.StringValue)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// recordAttrs 监控项或事件的属性
+// 除 resource 与 eventid 外的维度按名称顺序输出 基础维度使用 zabbix. 前缀
+func recordAttrs(rec *record.Record) []keyValue {
+	dims := rec.Dims()
+	var attrs []keyValue
+	if rec.Name != "" && rec.Type != record.TypeEvents {
+		attrs = append(attrs, stringAttr("zabbix.item.name", rec.Name))
+	}
+	if rec.ItemKey != "" {
+		attrs = append(attrs, stringAttr("zabbix.item.key", rec.ItemKey))
+	}
+	for _, t := range rec.ItemTags {
+		attrs = append(attrs, stringAttr("zabbix.tag."+t.Tag, t.Value))
+	}
+	for _, t := range rec.Tags {
+		attrs = append(attrs, stringAttr("zabbix.tag."+t.Tag, t.Value))
+	}
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		if _, ok := resourceDims[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name, ok := recordDims[k]
+		if !ok {
+			name = k
+		} else if name == "" {
+			continue
+		}
+		attrs = append(attrs, stringAttr(name, dims[k]))
+	}
+	return attrs
+}
+
+// dataPoint 将数值类 history 转换为 gauge 数据点
+func dataPoint(rec *record.Record) (numberDataPoint, bool) {
+	dp := numberDataPoint{
+		Attributes:   recordAttrs(rec),
+		TimeUnixNano: strconv.FormatInt(rec.TimestampNs(), 10),
+	}
+	if rec.ValueType == record.ValueTypeUint {
+		if _, err := strconv.ParseInt(string(rec.Value), 10, 64); err == nil {
+			dp.AsInt = string(rec.Value)
+			return dp, true
+		}
+	}
+	v, ok := rec.NumericValue()
+	if !ok {
+		return dp, false
+	}
+	dp.AsDouble = &v
+	return dp, true
+}
+
+// logOf 将文本类 history 与事件转换为日志记录
+func logOf(rec *record.Record, observed string) *logRecord {
+	lr := &logRecord{
+		TimeUnixNano:         strconv.FormatInt(rec.TimestampNs(), 10),
+		ObservedTimeUnixNano: observed,
+		Attributes:           recordAttrs(rec),
+	}
+	if rec.Type == record.TypeEvents {
+		body := rec.Name
+		lr.Body = anyValue{StringValue: &body}
+		lr.Attributes = append(lr.Attributes,
+			stringAttr("zabbix.eventid", strconv.FormatUint(rec.EventID, 10)),
+			boolAttr("zabbix.problem", rec.IsProblem()),
+		)
+		if rec.PEventID != 0 {
+			lr.Attributes = append(lr.Attributes, stringAttr("zabbix.p_eventid", strconv.FormatUint(rec.PEventID, 10)))
+		}
+		if rec.IsProblem() && rec.Severity >= 0 && rec.Severity < len(problemSeverity) {
+			lr.SeverityNumber = problemSeverity[rec.Severity].number
+			lr.SeverityText = problemSeverity[rec.Severity].text
+		} else {
+			lr.SeverityNumber = 9
+			lr.SeverityText = "Resolved"
+		}
+		return lr
+	}
+	body := rec.StringValue()
+	lr.Body = anyValue{StringValue: &body}
+	if rec.ValueType == record.ValueTypeLog && rec.Source != "" {
+		lr.Attributes = append(lr.Attributes, stringAttr("zabbix.log.source", rec.Source))
+	}
+	return lr
+}
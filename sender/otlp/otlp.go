@@ -0,0 +1,321 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/define"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+)
+
+var (
+	buffer            = 500
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRecords = 1000
+	defaultMaxLatency = time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	scopeName         = "zabbix-source"
+)
+
+func init() {
+	if err := sender.RegisterSender("otlp", NewOtlpSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type OtlpConfig struct {
+	// Endpoint OTLP/HTTP 地址 例如 http://127.0.0.1:4318
+	// 指标写入 /v1/metrics 日志写入 /v1/logs
+	Endpoint string            `mapstructure:"endpoint"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Gzip     bool              `mapstructure:"gzip"`
+	Timeout  time.Duration     `mapstructure:"timeout"`
+	Buffer   int               `mapstructure:"buffer"`
+	// MetricPrefix 指标名称前缀
+	MetricPrefix string `mapstructure:"metric_prefix"`
+	// MaxRecords 单次请求最多包含的记录数
+	MaxRecords int `mapstructure:"max_records"`
+	// MaxLatency 记录在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	MaxRetries int           `mapstructure:"max_retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+}
+
+// OtlpSender 以 OTLP/HTTP JSON 协议发送数据
+// 数值类 history 转为 gauge 文本 日志类 history 与问题事件转为日志记录
+type OtlpSender struct {
+	cfg    OtlpConfig
+	wg     sync.WaitGroup
+	ch     chan *record.Record
+	client *http.Client
+	// ctx 在 Stop 时取消 用于中断重试等待
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewOtlpSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := OtlpConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode otlp sender config: %v", err)
+		return nil
+	}
+	if c.Endpoint == "" {
+		logger.Errorf("otlp sender endpoint is required")
+		return nil
+	}
+	c.Endpoint = strings.TrimRight(c.Endpoint, "/")
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.MaxRecords <= 0 {
+		c.MaxRecords = defaultMaxRecords
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &OtlpSender{
+		cfg:    c,
+		wg:     sync.WaitGroup{},
+		ch:     make(chan *record.Record, c.Buffer),
+		client: &http.Client{Timeout: c.Timeout},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (o *OtlpSender) Name() string {
+	return "otlp"
+}
+
+func (o *OtlpSender) Run() error {
+	o.wg.Add(1)
+	go o.consume()
+	return nil
+}
+
+func (o *OtlpSender) consume() {
+	defer o.wg.Done()
+	var batch []*record.Record
+	ticker := time.NewTicker(o.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case rec, ok := <-o.ch:
+			if !ok {
+				o.flush(batch)
+				logger.Infof("otlp sender exiting")
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= o.cfg.MaxRecords {
+				o.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			o.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (o *OtlpSender) flush(batch []*record.Record) {
+	if len(batch) == 0 {
+		return
+	}
+	metrics, logs := o.requests(batch)
+	if len(metrics.ResourceMetrics) > 0 {
+		o.export("/v1/metrics", metrics)
+	}
+	if len(logs.ResourceLogs) > 0 {
+		o.export("/v1/logs", logs)
+	}
+}
+
+// requests 按主机分组组装指标与日志请求
+func (o *OtlpSender) requests(batch []*record.Record) (*metricsRequest, *logsRequest) {
+	sc := scope{Name: scopeName, Version: define.Version}
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	metrics := &metricsRequest{}
+	logs := &logsRequest{}
+	rmIndex := make(map[string]*resourceMetrics)
+	rlIndex := make(map[string]*resourceLogs)
+	metricIndex := make(map[string]*metric)
+
+	for _, rec := range batch {
+		attrs := resourceAttrs(rec)
+		host := attrsKey(attrs)
+		if rec.IsNumeric() {
+			dp, ok := dataPoint(rec)
+			if !ok {
+				continue
+			}
+			rm, ok := rmIndex[host]
+			if !ok {
+				rm = &resourceMetrics{
+					Resource:     resource{Attributes: attrs},
+					ScopeMetrics: []scopeMetrics{{Scope: sc}},
+				}
+				rmIndex[host] = rm
+				metrics.ResourceMetrics = append(metrics.ResourceMetrics, rm)
+			}
+			name := o.cfg.MetricPrefix + rec.MetricName()
+			m, ok := metricIndex[host+"\x00"+name]
+			if !ok {
+				m = &metric{Name: name}
+				metricIndex[host+"\x00"+name] = m
+				rm.ScopeMetrics[0].Metrics = append(rm.ScopeMetrics[0].Metrics, m)
+			}
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+			continue
+		}
+		rl, ok := rlIndex[host]
+		if !ok {
+			rl = &resourceLogs{
+				Resource:  resource{Attributes: attrs},
+				ScopeLogs: []scopeLogs{{Scope: sc}},
+			}
+			rlIndex[host] = rl
+			logs.ResourceLogs = append(logs.ResourceLogs, rl)
+		}
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, logOf(rec, observed))
+	}
+	return metrics, logs
+}
+
+func (o *OtlpSender) export(path string, req interface{}) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		logger.Errorf("otlp sender: marshal %s request failed: %v", path, err)
+		return
+	}
+	if o.cfg.Gzip {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			logger.Errorf("otlp sender: gzip %s request failed: %v", path, err)
+			return
+		}
+		data = buf.Bytes()
+	}
+	backoff := o.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := o.post(path, data)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= o.cfg.MaxRetries {
+			logger.Errorf("otlp sender: drop %s request after %d attempts: %v", path, attempt+1, err)
+			return
+		}
+		logger.Warnf("otlp sender: export %s failed, retry in %s: %v", path, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-o.ctx.Done():
+			logger.Errorf("otlp sender: stopped while retrying, drop %s request", path)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// post 发送一次请求 返回失败是否可以重试
+// 按 OTLP/HTTP 规范 429 502 503 504 可以重试
+func (o *OtlpSender) post(path string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, o.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range o.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, err
+	}
+	return false, err
+}
+
+// Push trends 记录不发送
+// Format 返回记录对应的 OTLP/HTTP 请求路径与 JSON 内容 用于 dry-run
+func (o *OtlpSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok || rec.Type == record.TypeTrends {
+		return nil, nil
+	}
+	var (
+		path string
+		req  interface{}
+	)
+	metrics, logs := o.requests([]*record.Record{rec})
+	switch {
+	case len(metrics.ResourceMetrics) > 0:
+		path, req = "/v1/metrics", metrics
+	case len(logs.ResourceLogs) > 0:
+		path, req = "/v1/logs", logs
+	default:
+		return nil, nil
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("POST "+o.cfg.Endpoint+path+" "), data...), nil
+}
+
+func (o *OtlpSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("otlp sender push failed: channel closed")
+		}
+	}()
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok || rec.Type == record.TypeTrends {
+		return
+	}
+	o.ch <- rec
+}
+
+func (o *OtlpSender) Stop() {
+	close(o.ch)
+	// 停止时不再等待重试
+	o.cancel()
+	o.wg.Wait()
+	logger.Infof("otlp sender stopped")
+}
@@ -0,0 +1,369 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+
+	"github.com/golang/snappy"
+)
+
+var (
+	buffer            = 500
+	defaultTimeout    = 10 * time.Second
+	defaultMaxSamples = 1000
+	defaultMaxLatency = 5 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = 30 * time.Second
+	defaultSeriesTTL  = time.Hour
+)
+
+func init() {
+	if err := sender.RegisterSender("prometheus", NewPromSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type PromConfig struct {
+	// URL remote write 接收地址
+	URL         string            `mapstructure:"url"`
+	Headers     map[string]string `mapstructure:"headers"`
+	BearerToken string            `mapstructure:"bearer_token"`
+	Username    string            `mapstructure:"username"`
+	Password    string            `mapstructure:"password"`
+	Timeout     time.Duration     `mapstructure:"timeout"`
+	Buffer      int               `mapstructure:"buffer"`
+	// MetricPrefix 指标名称前缀
+	MetricPrefix string `mapstructure:"metric_prefix"`
+	// MaxSamples 单个请求中最多包含的样本数
+	MaxSamples int `mapstructure:"max_samples"`
+	// MaxLatency 样本在批次中停留的最长时间
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	// MaxRetries 5xx 429 时的最大重试次数
+	MaxRetries int           `mapstructure:"max_retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	// MaxBackoff 重试等待时间上限
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// SeriesTTL 序列超过该时间没有新样本后不再检查乱序
+	SeriesTTL time.Duration `mapstructure:"series_ttl"`
+}
+
+type point struct {
+	key    string
+	labels []label
+	sample sample
+}
+
+// PromSender 将数值类 history 以 remote write 协议写入 Prometheus 兼容存储
+type PromSender struct {
+	cfg    PromConfig
+	wg     sync.WaitGroup
+	ch     chan *point
+	client *http.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// lastMu 保护 last 记录每个序列最后写入的样本 用于丢弃乱序样本
+	lastMu    sync.Mutex
+	last      map[string]lastSample
+	lastSweep time.Time
+}
+
+// lastSample 序列最后写入的样本时间戳 以及写入时的本地时间 过期按本地时间判断
+type lastSample struct {
+	ts   int64
+	seen time.Time
+}
+
+func NewPromSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := PromConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode prometheus sender config: %v", err)
+		return nil
+	}
+	if c.URL == "" {
+		logger.Errorf("prometheus sender url is required")
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.MaxSamples <= 0 {
+		c.MaxSamples = defaultMaxSamples
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.SeriesTTL <= 0 {
+		c.SeriesTTL = defaultSeriesTTL
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PromSender{
+		cfg:       c,
+		wg:        sync.WaitGroup{},
+		ch:        make(chan *point, c.Buffer),
+		client:    &http.Client{Timeout: c.Timeout},
+		ctx:       ctx,
+		cancel:    cancel,
+		last:      make(map[string]lastSample),
+		lastSweep: time.Now(),
+	}
+}
+
+func (p *PromSender) Name() string {
+	return "prometheus"
+}
+
+// Run 只启动一个发送 goroutine 保证同一序列的样本按顺序写入
+func (p *PromSender) Run() error {
+	p.wg.Add(1)
+	go p.consume()
+	return nil
+}
+
+// labels 将记录转换为 label 集合
+// 指标名称来自监控项 key 记录维度 Dims 与监控项标签作为 label
+func (p *PromSender) labels(rec *record.Record) []label {
+	labels := []label{{name: "__name__", value: p.cfg.MetricPrefix + rec.MetricName()}}
+	seen := map[string]bool{"__name__": true}
+	add := func(name, value string) {
+		name = record.SanitizeName(name)
+		if name == "" || seen[name] || value == "" {
+			return
+		}
+		seen[name] = true
+		labels = append(labels, label{name: name, value: value})
+	}
+	// 按名称顺序添加 清理后同名时结果稳定
+	dims := rec.Dims()
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, dims[k])
+	}
+	for _, t := range rec.ItemTags {
+		add("tag_"+t.Tag, t.Value)
+	}
+	sortLabels(labels)
+	return labels
+}
+
+func seriesKey(labels []label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.name)
+		b.WriteByte('=')
+		b.WriteString(l.value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// accept 判断样本是否晚于该序列最后写入的样本
+func (p *PromSender) accept(key string, ts int64) bool {
+	p.lastMu.Lock()
+	defer p.lastMu.Unlock()
+	now := time.Now()
+	if now.Sub(p.lastSweep) >= p.cfg.SeriesTTL {
+		p.sweep(now)
+	}
+	if last, ok := p.last[key]; ok && ts <= last.ts {
+		return false
+	}
+	p.last[key] = lastSample{ts: ts, seen: now}
+	return true
+}
+
+// sweep 清理长时间没有新样本的序列 调用方持有锁
+func (p *PromSender) sweep(now time.Time) {
+	p.lastSweep = now
+	expire := now.Add(-p.cfg.SeriesTTL)
+	for key, last := range p.last {
+		if last.seen.Before(expire) {
+			delete(p.last, key)
+		}
+	}
+}
+
+func (p *PromSender) consume() {
+	defer p.wg.Done()
+	batch := make(map[string]*series)
+	count := 0
+	ticker := time.NewTicker(p.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case pt, ok := <-p.ch:
+			if !ok {
+				p.flush(batch, count)
+				logger.Infof("prometheus sender exiting")
+				return
+			}
+			s, ok := batch[pt.key]
+			if !ok {
+				s = &series{labels: pt.labels}
+				batch[pt.key] = s
+			}
+			s.samples = append(s.samples, pt.sample)
+			count++
+			if count >= p.cfg.MaxSamples {
+				p.flush(batch, count)
+				batch = make(map[string]*series)
+				count = 0
+			}
+		case <-ticker.C:
+			p.flush(batch, count)
+			batch = make(map[string]*series)
+			count = 0
+		}
+	}
+}
+
+func (p *PromSender) flush(batch map[string]*series, count int) {
+	if count == 0 {
+		return
+	}
+	list := make([]*series, 0, len(batch))
+	for _, s := range batch {
+		list = append(list, s)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(list))
+	backoff := p.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := p.post(body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= p.cfg.MaxRetries {
+			logger.Errorf("prometheus sender: drop %d samples after %d attempts: %v", count, attempt+1, err)
+			return
+		}
+		logger.Warnf("prometheus sender: remote write failed, retry in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			logger.Errorf("prometheus sender: stopped while retrying, drop %d samples", count)
+			return
+		}
+		backoff *= 2
+		if backoff > p.cfg.MaxBackoff {
+			backoff = p.cfg.MaxBackoff
+		}
+	}
+}
+
+// post 发送一次 remote write 请求 返回失败是否可以重试
+func (p *PromSender) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if p.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	} else if p.cfg.Username != "" {
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Push 只处理数值类 history 记录 其他记录直接忽略
+// Format 返回样本的文本形式 用于 dry-run
+// 实际以 protobuf 编码 格式与 Prometheus 文本格式一致 时间戳为毫秒
+func (p *PromSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok || rec.Type != record.TypeHistory {
+		return nil, nil
+	}
+	v, ok := rec.NumericValue()
+	if !ok {
+		return nil, nil
+	}
+	var (
+		metric string
+		pairs  []string
+	)
+	for _, l := range p.labels(rec) {
+		if l.name == "__name__" {
+			metric = l.value
+			continue
+		}
+		pairs = append(pairs, l.name+"="+strconv.Quote(l.value))
+	}
+	line := fmt.Sprintf("%s{%s} %s %d", metric, strings.Join(pairs, ","), strconv.FormatFloat(v, 'g', -1, 64), rec.TimestampMs())
+	return []byte(line), nil
+}
+
+func (p *PromSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("prometheus sender push failed: channel closed")
+		}
+	}()
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok || rec.Type != record.TypeHistory {
+		return
+	}
+	v, ok := rec.NumericValue()
+	if !ok {
+		return
+	}
+	labels := p.labels(rec)
+	key := seriesKey(labels)
+	ts := rec.TimestampMs()
+	if !p.accept(key, ts) {
+		logger.Debugf("prometheus sender: drop out of order sample %s%s at %d", p.cfg.MetricPrefix, rec.MetricName(), ts)
+		return
+	}
+	p.ch <- &point{key: key, labels: labels, sample: sample{value: v, timestamp: ts}}
+}
+
+func (p *PromSender) Stop() {
+	close(p.ch)
+	// 停止时不再等待重试
+	p.cancel()
+	p.wg.Wait()
+	logger.Infof("prometheus sender stopped")
+}
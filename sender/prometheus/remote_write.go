@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// 按 prometheus remote write 协议 prompb.WriteRequest 手工编码 protobuf
+// message WriteRequest { repeated TimeSeries timeseries = 1; }
+// message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+// message Label        { string name = 1; string value = 2; }
+// message Sample       { double value = 1; int64 timestamp = 2; }
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+type series struct {
+	labels  []label
+	samples []sample
+}
+
+// sortLabels remote write 要求 label 按名称排序
+func sortLabels(labels []label) {
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func encodeLabel(l label) []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(l.name))
+	b = appendBytesField(b, 2, []byte(l.value))
+	return b
+}
+
+func encodeSample(s sample) []byte {
+	var b []byte
+	b = appendTag(b, 1, wireFixed64)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.value))
+	b = appendTag(b, 2, wireVarint)
+	b = binary.AppendUvarint(b, uint64(s.timestamp))
+	return b
+}
+
+func encodeSeries(s *series) []byte {
+	var b []byte
+	for _, l := range s.labels {
+		b = appendBytesField(b, 1, encodeLabel(l))
+	}
+	for _, smp := range s.samples {
+		b = appendBytesField(b, 2, encodeSample(smp))
+	}
+	return b
+}
+
+// encodeWriteRequest 编码 WriteRequest 结果需再经过 snappy 压缩
+func encodeWriteRequest(series []*series) []byte {
+	var b []byte
+	for _, s := range series {
+		b = appendBytesField(b, 1, encodeSeries(s))
+	}
+	return b
+}
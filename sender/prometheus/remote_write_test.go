@@ -0,0 +1,173 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// field 测试中解码得到的 protobuf 字段
+type field struct {
+	num  int
+	wire int
+	// varint 或 fixed64 的值
+	u uint64
+	// bytes 类型的内容
+	data []byte
+}
+
+// decodeFields 按 protobuf wire 格式解码一层消息 只支持编码器使用到的类型
+func decodeFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("bad tag")
+		}
+		b = b[n:]
+		f := field{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.u, n = binary.Uvarint(b); n <= 0 {
+				return nil, fmt.Errorf("bad varint in field %d", f.num)
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("short fixed64 in field %d", f.num)
+			}
+			f.u, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, fmt.Errorf("bad length in field %d", f.num)
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// decodeWriteRequest 将编码结果还原为 series 用于与输入比较
+func decodeWriteRequest(t *testing.T, b []byte) []*series {
+	t.Helper()
+	must := func(fields []field, err error) []field {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return fields
+	}
+	var result []*series
+	for _, f := range must(decodeFields(b)) {
+		if f.num != 1 || f.wire != wireBytes {
+			t.Fatalf("WriteRequest unexpected field %d wire %d", f.num, f.wire)
+		}
+		s := &series{}
+		for _, sf := range must(decodeFields(f.data)) {
+			switch {
+			case sf.num == 1 && sf.wire == wireBytes:
+				var l label
+				for _, lf := range must(decodeFields(sf.data)) {
+					switch {
+					case lf.num == 1 && lf.wire == wireBytes:
+						l.name = string(lf.data)
+					case lf.num == 2 && lf.wire == wireBytes:
+						l.value = string(lf.data)
+					default:
+						t.Fatalf("Label unexpected field %d wire %d", lf.num, lf.wire)
+					}
+				}
+				s.labels = append(s.labels, l)
+			case sf.num == 2 && sf.wire == wireBytes:
+				var smp sample
+				for _, pf := range must(decodeFields(sf.data)) {
+					switch {
+					case pf.num == 1 && pf.wire == wireFixed64:
+						smp.value = math.Float64frombits(pf.u)
+					case pf.num == 2 && pf.wire == wireVarint:
+						smp.timestamp = int64(pf.u)
+					default:
+						t.Fatalf("Sample unexpected field %d wire %d", pf.num, pf.wire)
+					}
+				}
+				s.samples = append(s.samples, smp)
+			default:
+				t.Fatalf("TimeSeries unexpected field %d wire %d", sf.num, sf.wire)
+			}
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestEncodeWriteRequestBytes(t *testing.T) {
+	got := encodeWriteRequest([]*series{{
+		labels:  []label{{name: "__name__", value: "up"}},
+		samples: []sample{{value: 1, timestamp: 1000}},
+	}})
+	want := []byte{
+		0x0a, 0x1e, // timeseries 30 字节
+		0x0a, 0x0e, // labels 14 字节
+		0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_',
+		0x12, 0x02, 'u', 'p',
+		0x12, 0x0c, // samples 12 字节
+		0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f,
+		0x10, 0xe8, 0x07,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeWriteRequest = % x\nwant % x", got, want)
+	}
+}
+
+func TestEncodeWriteRequestRoundTrip(t *testing.T) {
+	in := []*series{
+		{
+			labels: []label{
+				{name: "__name__", value: "zabbix_system_cpu_util"},
+				{name: "host", value: "主机-01"},
+				{name: "long", value: strings.Repeat("x", 300)},
+			},
+			samples: []sample{
+				{value: 12.5, timestamp: 1700000000123},
+				{value: -0.25, timestamp: 1700000001123},
+				{value: math.Inf(1), timestamp: -1},
+			},
+		},
+		{
+			labels:  []label{{name: "__name__", value: "empty_value"}, {name: "tag", value: ""}},
+			samples: []sample{{value: 0, timestamp: 0}},
+		},
+	}
+	got := decodeWriteRequest(t, encodeWriteRequest(in))
+	if len(got) != len(in) {
+		t.Fatalf("decoded %d series, want %d", len(got), len(in))
+	}
+	for i := range in {
+		if !reflect.DeepEqual(got[i], in[i]) {
+			t.Errorf("series %d = %+v, want %+v", i, got[i], in[i])
+		}
+	}
+	if b := encodeWriteRequest(nil); len(b) != 0 {
+		t.Errorf("empty request encoded to % x", b)
+	}
+}
+
+func TestSortLabels(t *testing.T) {
+	labels := []label{{name: "itemid"}, {name: "__name__"}, {name: "host"}, {name: "groups"}}
+	sortLabels(labels)
+	var names []string
+	for _, l := range labels {
+		names = append(names, l.name)
+	}
+	if got := strings.Join(names, ","); got != "__name__,groups,host,itemid" {
+		t.Errorf("sortLabels = %s", got)
+	}
+}
@@ -4,10 +4,23 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"zabbix-source/config"
 	"zabbix-source/logger"
 )
 
+var (
+	defaultQueueSize = 500
+	// primaryType 主要的发送目标 队列满时默认阻塞 其余类型默认丢弃
+	// 阻塞的队列会阻塞全部分发 goroutine 次要目标变慢时不能影响 GSE
+	primaryType = "gse"
+)
+
+const (
+	OverflowBlock = "block"
+	OverflowDrop  = "drop"
+)
+
 // SenderMsg 消息接口
 // 负责提供消息数据和补充信息
 // 补充信息用于具体的Sender实现
@@ -16,8 +29,9 @@ type SenderMsg interface {
 	GetData() []byte
 	// GetOptions 返回消息的补充信息
 	GetOptions() map[string]interface{}
-	// GetSender 返回消息的发送者
-	GetSender() string
+	// GetSenders 返回消息需要发送到的 Sender 实例名称
+	// 每个 Sender 实例会收到一份独立的消息副本
+	GetSenders() []string
 }
 
 // SenderInstance Sender 实例接口
@@ -43,11 +57,56 @@ func RegisterSender(name string, factory func(config.SenderConfig) SenderInstanc
 	return nil
 }
 
+// instanceConfig Sender 实例的公共配置
+// 与 Sender 自身的配置写在一起 由 SenderService 解析
+type instanceConfig struct {
+	// Type Sender 类型 为空时使用实例名称
+	Type string `mapstructure:"type"`
+	// QueueSize 实例独立队列的长度
+	QueueSize int `mapstructure:"queue_size"`
+	// Overflow 队列满时的处理方式 block 阻塞等待 drop 丢弃消息
+	// 为空时 gse 为 block 其余为 drop
+	Overflow string `mapstructure:"overflow"`
+}
+
+// senderQueue 每个 Sender 实例独立的发送队列
+// 慢的 Sender 只会阻塞或丢弃自身的消息 不影响其他 Sender
+type senderQueue struct {
+	name     string
+	instance SenderInstance
+	ch       chan SenderMsg
+	drop     bool
+	dropped  atomic.Uint64
+}
+
+func (q *senderQueue) push(msg SenderMsg) {
+	if !q.drop {
+		q.ch <- msg
+		return
+	}
+	select {
+	case q.ch <- msg:
+	default:
+		if n := q.dropped.Add(1); n%1000 == 1 {
+			logger.Warnf("sender %s queue is full, %d messages dropped so far", q.name, n)
+		}
+	}
+}
+
+func (q *senderQueue) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for msg := range q.ch {
+		q.instance.Push(msg)
+	}
+	logger.Infof("sender %s queue exit", q.name)
+}
+
 type SenderService struct {
-	wg        sync.WaitGroup
-	conf      map[string]config.SenderConfig
-	msgChan   chan SenderMsg
-	instances map[string]SenderInstance
+	wg      sync.WaitGroup
+	queueWg sync.WaitGroup
+	conf    map[string]config.SenderConfig
+	msgChan chan SenderMsg
+	queues  map[string]*senderQueue
 }
 
 func NewSenderService(conf map[string]config.SenderConfig) (*SenderService, error) {
@@ -55,10 +114,11 @@ func NewSenderService(conf map[string]config.SenderConfig) (*SenderService, erro
 		return nil, fmt.Errorf("no sender configurations provided")
 	}
 	return &SenderService{
-		wg:        sync.WaitGroup{},
-		conf:      conf,
-		msgChan:   make(chan SenderMsg, 500),
-		instances: make(map[string]SenderInstance),
+		wg:      sync.WaitGroup{},
+		queueWg: sync.WaitGroup{},
+		conf:    conf,
+		msgChan: make(chan SenderMsg, 500),
+		queues:  make(map[string]*senderQueue),
 	}, nil
 }
 
@@ -68,9 +128,32 @@ func NewSenderService(conf map[string]config.SenderConfig) (*SenderService, erro
 func (s *SenderService) Start() error {
 	var errArray []error
 	for name, cfg := range s.conf {
-		factory, ok := senderFactory[name]
+		ic := instanceConfig{}
+		if err := cfg.To(&ic); err != nil {
+			errArray = append(errArray, fmt.Errorf("failed to decode sender %s config: %v", name, err))
+			continue
+		}
+		if ic.Type == "" {
+			ic.Type = name
+		}
+		switch ic.Overflow {
+		case "":
+			ic.Overflow = OverflowDrop
+			if ic.Type == primaryType {
+				ic.Overflow = OverflowBlock
+			}
+		case OverflowDrop:
+		case OverflowBlock:
+			if ic.Type != primaryType {
+				logger.Warnf("sender %s uses overflow block, a full queue will stall all other senders", name)
+			}
+		default:
+			errArray = append(errArray, fmt.Errorf("sender %s has unknown overflow %s", name, ic.Overflow))
+			continue
+		}
+		factory, ok := senderFactory[ic.Type]
 		if !ok {
-			errArray = append(errArray, fmt.Errorf("sender %s not registered", name))
+			errArray = append(errArray, fmt.Errorf("sender %s not registered", ic.Type))
 			continue
 		}
 		sender := factory(cfg)
@@ -82,7 +165,18 @@ func (s *SenderService) Start() error {
 			errArray = append(errArray, fmt.Errorf("failed to run sender %s: %v", sender.Name(), err))
 			continue
 		}
-		s.instances[name] = sender
+		if ic.QueueSize <= 0 {
+			ic.QueueSize = defaultQueueSize
+		}
+		q := &senderQueue{
+			name:     name,
+			instance: sender,
+			ch:       make(chan SenderMsg, ic.QueueSize),
+			drop:     ic.Overflow == OverflowDrop,
+		}
+		s.queues[name] = q
+		s.queueWg.Add(1)
+		go q.run(&s.queueWg)
 	}
 	var errMsgs []string
 	for _, err := range errArray {
@@ -100,25 +194,43 @@ func (s *SenderService) Start() error {
 	return nil
 }
 
+// Push 将消息交给 SenderService 分发
+func (s *SenderService) Push(msg SenderMsg) {
+	s.msgChan <- msg
+}
+
 // dispatch SenderService 消息分发
+// 消息会被复制给其指定的每一个 Sender 实例
 func (s *SenderService) dispatch(index int) {
 	defer s.wg.Done()
 	for msg := range s.msgChan {
-		name := msg.GetSender()
-		sender, ok := s.instances[name]
-		if !ok {
-			logger.Errorf("dispatch to sender %s, instance not found", name)
-			continue
+		names := msg.GetSenders()
+		for _, name := range names {
+			q, ok := s.queues[name]
+			if !ok {
+				logger.Errorf("dispatch to sender %s, instance not found", name)
+				continue
+			}
+			if len(names) == 1 {
+				q.push(msg)
+				continue
+			}
+			q.push(copyMsg(msg, name))
 		}
-		sender.Push(msg)
 	}
 	logger.Infof("dispatch goroutine %d exit", index)
 }
 
+// Stop 停止 SenderService
+// 先停止分发 再等待各实例队列消费完毕 最后停止 Sender 实例
 func (s *SenderService) Stop() {
-	for _, sender := range s.instances {
-		sender.Stop()
-	}
 	close(s.msgChan)
 	s.wg.Wait()
+	for _, q := range s.queues {
+		close(q.ch)
+	}
+	s.queueWg.Wait()
+	for _, q := range s.queues {
+		q.instance.Stop()
+	}
 }
@@ -0,0 +1,175 @@
+package stdout
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/sender"
+	"zabbix-source/sender/gse/payload"
+)
+
+var (
+	// mu 多个实例共享标准输出 避免输出行交错
+	mu sync.Mutex
+)
+
+func init() {
+	if err := sender.RegisterSender("stdout", NewStdoutSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type StdoutConfig struct {
+	// Target 输出目标 stdout stderr
+	Target string `mapstructure:"target"`
+	// Label 输出行的前缀 dry-run 模式下为被替换的 Sender 实例名称
+	Label string `mapstructure:"label"`
+	// Format point 逐条输出数据点 gse 按 dataid 聚合后输出 GSE 实际接收的 payload
+	// sender 使用 Sender 配置对应的 Sender 格式化后输出实际发送的内容
+	Format string `mapstructure:"format"`
+	// Batch format 为 gse 时的批量配置 与 GSE Sender 一致
+	Batch payload.BatchConfig `mapstructure:"batch"`
+	// Sender format 为 sender 时被替换的 Sender 配置 包括 type
+	Sender config.SenderConfig `mapstructure:"sender"`
+}
+
+// StdoutSender 将消息数据与 dataid 打印到标准输出
+// 用于调试路由与数据格式
+type StdoutSender struct {
+	cfg StdoutConfig
+	out io.Writer
+
+	// format 为 sender 时使用
+	formatter sender.Formatter
+
+	// format 为 gse 时使用
+	wg      sync.WaitGroup
+	batchMu sync.Mutex
+	batcher *payload.Batcher
+	stop    chan struct{}
+}
+
+func NewStdoutSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := StdoutConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode stdout sender config: %v", err)
+		return nil
+	}
+	if c.Label == "" {
+		c.Label = "stdout"
+	}
+	s := &StdoutSender{cfg: c}
+	switch c.Target {
+	case "", "stdout":
+		s.out = os.Stdout
+	case "stderr":
+		s.out = os.Stderr
+	default:
+		logger.Errorf("stdout sender unknown target %s", c.Target)
+		return nil
+	}
+	switch c.Format {
+	case "", "point":
+	case "gse":
+		s.cfg.Batch.SetDefaults()
+		s.batcher = payload.NewBatcher(s.cfg.Batch, s.printPayload)
+		s.stop = make(chan struct{})
+	case sender.FormatSender:
+		f, err := sender.NewFormatter(c.Sender)
+		if err != nil {
+			logger.Errorf("stdout sender %s: %v", c.Label, err)
+			return nil
+		}
+		s.formatter = f
+	default:
+		logger.Errorf("stdout sender unknown format %s", c.Format)
+		return nil
+	}
+	return s
+}
+
+func (s *StdoutSender) Name() string {
+	return "stdout"
+}
+
+func (s *StdoutSender) Run() error {
+	if s.batcher == nil {
+		return nil
+	}
+	s.wg.Add(1)
+	go s.tick()
+	return nil
+}
+
+// tick 与 GSE Sender 相同 按 max_latency 输出超时的批次
+func (s *StdoutSender) tick() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.Batch.TickInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.batchMu.Lock()
+			s.batcher.FlushExpired()
+			s.batchMu.Unlock()
+		}
+	}
+}
+
+func (s *StdoutSender) printPayload(dataid int32, data []byte, count int) {
+	s.print("[%s] dataid=%d records=%d %s\n", s.cfg.Label, dataid, count, data)
+}
+
+func (s *StdoutSender) print(format string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := fmt.Fprintf(s.out, format, args...); err != nil {
+		logger.Errorf("stdout sender failed to write: %v", err)
+	}
+}
+
+func (s *StdoutSender) Push(msg sender.SenderMsg) {
+	options := msg.GetOptions()
+	if s.formatter != nil {
+		data, err := s.formatter.Format(msg)
+		switch {
+		case err != nil:
+			s.print("[%s] route=%v format failed: %v\n", s.cfg.Label, options["route"], err)
+		case data == nil:
+			s.print("[%s] route=%v not sent by %v sender\n", s.cfg.Label, options["route"], s.cfg.Sender["type"])
+		default:
+			s.print("[%s] route=%v %s\n", s.cfg.Label, options["route"], bytes.TrimRight(data, "\n"))
+		}
+		return
+	}
+	if s.batcher == nil {
+		s.print("[%s] route=%v dataid=%v %s\n", s.cfg.Label, options["route"], options["dataid"], msg.GetData())
+		return
+	}
+	dataid, ok := options["dataid"].(int32)
+	if !ok {
+		s.print("[%s] route=%v missing dataid, GSE would drop %s\n", s.cfg.Label, options["route"], msg.GetData())
+		return
+	}
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+	s.batcher.Add(dataid, msg.GetData())
+}
+
+func (s *StdoutSender) Stop() {
+	if s.batcher != nil {
+		close(s.stop)
+		s.wg.Wait()
+		s.batchMu.Lock()
+		s.batcher.FlushAll()
+		s.batchMu.Unlock()
+	}
+	logger.Infof("stdout sender %s stopped", s.cfg.Label)
+}
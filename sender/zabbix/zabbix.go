@@ -0,0 +1,333 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/sender"
+	"zabbix-source/zbxproto"
+)
+
+var (
+	buffer            = 500
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRecords = 250
+	defaultMaxLatency = time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	maxResponseSize   = int64(1 << 20)
+)
+
+func init() {
+	if err := sender.RegisterSender("zabbix", NewZabbixSender); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// RewriteConfig 主机与 key 改写规则
+// 记录按顺序匹配 使用第一条命中的规则改写 未命中时保持原样
+type RewriteConfig struct {
+	// Host 主机名 glob 为空时匹配全部
+	Host string `mapstructure:"host"`
+	// Key 监控项 key 正则 为空时匹配全部
+	Key string `mapstructure:"key"`
+	// HostTo 改写后的主机名 支持 {host} 占位符
+	HostTo string `mapstructure:"host_to"`
+	// KeyTo 改写后的 key 支持 Key 正则的 $1 等分组引用
+	KeyTo string `mapstructure:"key_to"`
+}
+
+type ZabbixConfig struct {
+	// Addr 目标 Zabbix server 或 proxy 的 trapper 地址
+	Addr     string        `mapstructure:"addr"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Buffer   int           `mapstructure:"buffer"`
+	Compress bool          `mapstructure:"compress"`
+	// MaxRecords 单次请求最多包含的值
+	MaxRecords int `mapstructure:"max_records"`
+	// MaxLatency 值在批次中停留的最长时间
+	MaxLatency time.Duration   `mapstructure:"max_latency"`
+	MaxRetries int             `mapstructure:"max_retries"`
+	Backoff    time.Duration   `mapstructure:"backoff"`
+	Rewrites   []RewriteConfig `mapstructure:"rewrites"`
+}
+
+type rewrite struct {
+	conf RewriteConfig
+	key  *regexp.Regexp
+}
+
+// ZabbixSender 通过 zabbix_sender 协议将 history 转发到另一个 Zabbix
+// 目标 Zabbix 上需要存在对应的 trapper 监控项
+type ZabbixSender struct {
+	cfg      ZabbixConfig
+	wg       sync.WaitGroup
+	ch       chan zbxproto.SenderItem
+	rewrites []*rewrite
+	// ctx 在 Stop 时取消 用于中断重试等待
+	ctx    context.Context
+	cancel context.CancelFunc
+	// noKey 因没有监控项 key 丢弃的记录数
+	noKey atomic.Uint64
+}
+
+func NewZabbixSender(cfg config.SenderConfig) sender.SenderInstance {
+	c := ZabbixConfig{}
+	if err := cfg.To(&c); err != nil {
+		logger.Errorf("failed to decode zabbix sender config: %v", err)
+		return nil
+	}
+	if c.Addr == "" {
+		logger.Errorf("zabbix sender addr is required")
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = buffer
+	}
+	if c.MaxRecords <= 0 {
+		c.MaxRecords = defaultMaxRecords
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultMaxLatency
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	var rewrites []*rewrite
+	for _, rc := range c.Rewrites {
+		if _, err := path.Match(rc.Host, ""); err != nil {
+			logger.Errorf("zabbix sender invalid host pattern %s: %v", rc.Host, err)
+			return nil
+		}
+		rw := &rewrite{conf: rc}
+		if rc.Key != "" {
+			re, err := regexp.Compile(rc.Key)
+			if err != nil {
+				logger.Errorf("zabbix sender invalid key pattern %s: %v", rc.Key, err)
+				return nil
+			}
+			rw.key = re
+		}
+		rewrites = append(rewrites, rw)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ZabbixSender{
+		cfg:      c,
+		wg:       sync.WaitGroup{},
+		ch:       make(chan zbxproto.SenderItem, c.Buffer),
+		rewrites: rewrites,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (z *ZabbixSender) Name() string {
+	return "zabbix"
+}
+
+func (z *ZabbixSender) Run() error {
+	z.wg.Add(1)
+	go z.consume()
+	return nil
+}
+
+// rewrite 返回改写后的主机名与 key
+func (z *ZabbixSender) rewrite(host, key string) (string, string) {
+	for _, rw := range z.rewrites {
+		if rw.conf.Host != "" {
+			if ok, _ := path.Match(rw.conf.Host, host); !ok {
+				continue
+			}
+		}
+		var match []int
+		if rw.key != nil {
+			if match = rw.key.FindStringSubmatchIndex(key); match == nil {
+				continue
+			}
+		}
+		newHost, newKey := host, key
+		if rw.conf.HostTo != "" {
+			newHost = strings.ReplaceAll(rw.conf.HostTo, "{host}", host)
+		}
+		if rw.conf.KeyTo != "" {
+			if rw.key != nil {
+				newKey = string(rw.key.ExpandString(nil, rw.conf.KeyTo, key, match))
+			} else {
+				newKey = rw.conf.KeyTo
+			}
+		}
+		return newHost, newKey
+	}
+	return host, key
+}
+
+func (z *ZabbixSender) consume() {
+	defer z.wg.Done()
+	var batch []zbxproto.SenderItem
+	ticker := time.NewTicker(z.cfg.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case item, ok := <-z.ch:
+			if !ok {
+				z.flush(batch)
+				logger.Infof("zabbix sender exiting")
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= z.cfg.MaxRecords {
+				z.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			z.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (z *ZabbixSender) flush(batch []zbxproto.SenderItem) {
+	if len(batch) == 0 {
+		return
+	}
+	now := time.Now()
+	data, err := json.Marshal(zbxproto.SenderRequest{
+		Request: zbxproto.RequestSenderData,
+		Data:    batch,
+		Clock:   now.Unix(),
+		Ns:      int64(now.Nanosecond()),
+	})
+	if err != nil {
+		logger.Errorf("zabbix sender: marshal request failed: %v", err)
+		return
+	}
+	backoff := z.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		result, err := z.send(data)
+		if err == nil {
+			if result.Failed > 0 {
+				logger.Warnf("zabbix sender: %d of %d values failed on %s, check trapper items", result.Failed, result.Total, z.cfg.Addr)
+			}
+			return
+		}
+		if attempt >= z.cfg.MaxRetries {
+			logger.Errorf("zabbix sender: drop %d values after %d attempts: %v", len(batch), attempt+1, err)
+			return
+		}
+		logger.Warnf("zabbix sender: send to %s failed, retry in %s: %v", z.cfg.Addr, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-z.ctx.Done():
+			logger.Errorf("zabbix sender: stopped while retrying, drop %d values", len(batch))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// send 建立连接发送一次请求 Zabbix 在响应后会关闭连接
+func (z *ZabbixSender) send(data []byte) (zbxproto.Result, error) {
+	conn, err := net.DialTimeout("tcp", z.cfg.Addr, z.cfg.Timeout)
+	if err != nil {
+		return zbxproto.Result{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(z.cfg.Timeout))
+	if err := zbxproto.Write(conn, data, z.cfg.Compress); err != nil {
+		return zbxproto.Result{}, fmt.Errorf("write request failed: %w", err)
+	}
+	body, err := zbxproto.Read(conn, maxResponseSize)
+	if err != nil {
+		return zbxproto.Result{}, fmt.Errorf("read response failed: %w", err)
+	}
+	resp := zbxproto.SenderResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return zbxproto.Result{}, fmt.Errorf("unmarshal response failed: %w", err)
+	}
+	if resp.Response != zbxproto.ResponseSuccess {
+		return zbxproto.Result{}, fmt.Errorf("zabbix response %s: %s", resp.Response, resp.Info)
+	}
+	return zbxproto.ParseInfo(resp.Info)
+}
+
+// item 将 history 记录转换为 zabbix_sender 协议中的值 没有监控项 key 的记录无法转发
+// 未启用元数据缓存时 从数据库读取的 history 没有 key 丢弃时按数量输出告警
+func (z *ZabbixSender) item(rec *record.Record) (zbxproto.SenderItem, bool) {
+	if rec.Type != record.TypeHistory {
+		return zbxproto.SenderItem{}, false
+	}
+	if rec.ItemKey == "" {
+		if n := z.noKey.Add(1); n%1000 == 1 {
+			logger.Warnf("zabbix sender: item %d has no key, %d records without key dropped so far, enable cache_config to resolve item keys", rec.ItemID, n)
+		}
+		return zbxproto.SenderItem{}, false
+	}
+	host, key := z.rewrite(rec.HostName(), rec.ItemKey)
+	return zbxproto.SenderItem{
+		Host:  host,
+		Key:   key,
+		Value: rec.StringValue(),
+		Clock: rec.Clock,
+		Ns:    rec.Ns,
+	}, true
+}
+
+// Format 返回只包含该值的 sender data 请求 JSON 用于 dry-run
+// 实际发送时多个值合并为一个请求 并加上 ZBXD 协议头
+func (z *ZabbixSender) Format(msg sender.SenderMsg) ([]byte, error) {
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok {
+		return nil, nil
+	}
+	item, ok := z.item(rec)
+	if !ok {
+		return nil, nil
+	}
+	return json.Marshal(zbxproto.SenderRequest{
+		Request: zbxproto.RequestSenderData,
+		Data:    []zbxproto.SenderItem{item},
+	})
+}
+
+// Push 只转发 history 记录
+func (z *ZabbixSender) Push(msg sender.SenderMsg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("zabbix sender push failed: channel closed")
+		}
+	}()
+	rec, ok := msg.GetOptions()["record"].(*record.Record)
+	if !ok {
+		return
+	}
+	if item, ok := z.item(rec); ok {
+		z.ch <- item
+	}
+}
+
+func (z *ZabbixSender) Stop() {
+	close(z.ch)
+	// 停止时不再等待重试
+	z.cancel()
+	z.wg.Wait()
+	if n := z.noKey.Load(); n > 0 {
+		logger.Warnf("zabbix sender: %d records without key dropped", n)
+	}
+	logger.Infof("zabbix sender stopped")
+}
@@ -0,0 +1,378 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/source"
+)
+
+var (
+	defaultPollInterval  = time.Second
+	defaultStateInterval = 5 * time.Second
+	defaultReadSize      = 1 << 20
+	defaultMaxLineSize   = 16 << 20
+)
+
+const (
+	StartBeginning = "beginning"
+	StartEnd       = "end"
+)
+
+func init() {
+	if err := source.RegisterSource("file", NewFileSource); err != nil {
+		fmt.Printf("failed to register file source: %v\n", err)
+	}
+}
+
+type FileConfig struct {
+	// Paths 需要读取的文件 glob 例如 /var/lib/zabbix/export/history-*.ndjson
+	Paths []string `mapstructure:"paths"`
+	// StateFile 读取进度的保存路径
+	StateFile string `mapstructure:"state_file"`
+	// StartAt 首次启动且没有读取进度时 已存在文件的读取位置 beginning end
+	// 运行中新出现的文件总是从头读取
+	StartAt string `mapstructure:"start_at"`
+	// PollInterval 扫描文件的间隔
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// StateInterval 保存读取进度的间隔 越短异常退出后重复的数据越少
+	StateInterval time.Duration `mapstructure:"state_interval"`
+	// ReadSize 单次读取的字节数
+	ReadSize int `mapstructure:"read_size"`
+	// MaxLineSize 单行的最大字节数 超过时跳过该行
+	MaxLineSize int `mapstructure:"max_line_size"`
+}
+
+// fileState 单个文件的读取进度 以设备号与 inode 标识文件
+// 文件被 Zabbix 重命名切割后仍能识别为同一个文件
+type fileState struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+type tracked struct {
+	fileState
+	file *os.File
+	seen bool
+	// skipping 正在丢弃超长行的剩余部分 直到下一个换行
+	skipping bool
+}
+
+// FileSource 读取 Zabbix 实时导出写入的本地 NDJSON 文件
+// 跟随文件切割 并将读取进度保存在状态文件中 重启后从上次的位置继续
+// 数据交给处理流程后即推进内存中的读取进度 进度每隔 StateInterval 以及退出时写入状态文件
+// 进程异常退出时 上次保存之后读取的行重启后会重复发送 已保存进度但仍在队列中的数据会丢失
+// 因此既不是至多一次也不是至少一次
+type FileSource struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conf  FileConfig
+	ch    chan<- []byte
+	files map[string]*tracked
+	// saved 状态文件中的读取进度 文件首次出现时使用
+	saved map[string]fileState
+	first bool
+}
+
+func NewFileSource(conf config.SourceConfig) source.SourceInstance {
+	c := FileConfig{}
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode file source config: %v", err)
+		return nil
+	}
+	if len(c.Paths) == 0 {
+		logger.Errorf("file source paths is required")
+		return nil
+	}
+	for _, p := range c.Paths {
+		if _, err := filepath.Match(p, ""); err != nil {
+			logger.Errorf("file source invalid path pattern %s: %v", p, err)
+			return nil
+		}
+	}
+	if c.StateFile == "" {
+		logger.Errorf("file source state_file is required")
+		return nil
+	}
+	if c.StartAt == "" {
+		c.StartAt = StartBeginning
+	}
+	if c.StartAt != StartBeginning && c.StartAt != StartEnd {
+		logger.Errorf("file source unknown start_at %s", c.StartAt)
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.StateInterval <= 0 {
+		c.StateInterval = defaultStateInterval
+	}
+	if c.ReadSize <= 0 {
+		c.ReadSize = defaultReadSize
+	}
+	if c.MaxLineSize <= 0 {
+		c.MaxLineSize = defaultMaxLineSize
+	}
+	return &FileSource{
+		wg:    sync.WaitGroup{},
+		conf:  c,
+		files: make(map[string]*tracked),
+		saved: make(map[string]fileState),
+	}
+}
+
+func (f *FileSource) Name() string {
+	return "file"
+}
+
+func (f *FileSource) Run(ch chan<- []byte) error {
+	if err := f.loadState(); err != nil {
+		return err
+	}
+	f.ch = ch
+	f.first = len(f.saved) == 0
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	f.wg.Add(1)
+	go f.run()
+	return nil
+}
+
+func (f *FileSource) run() {
+	defer f.wg.Done()
+	pollTicker := time.NewTicker(f.conf.PollInterval)
+	defer pollTicker.Stop()
+	stateTicker := time.NewTicker(f.conf.StateInterval)
+	defer stateTicker.Stop()
+	f.poll()
+	for {
+		select {
+		case <-f.ctx.Done():
+			f.saveStateLogged()
+			for _, t := range f.files {
+				t.file.Close()
+			}
+			logger.Infof("file source exiting")
+			return
+		case <-pollTicker.C:
+			f.poll()
+		case <-stateTicker.C:
+			f.saveStateLogged()
+		}
+	}
+}
+
+func fileID(fi os.FileInfo) (string, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), true
+}
+
+// poll 扫描 glob 匹配的文件并读取新增内容
+// 已经不再匹配的文件 例如被重命名切割的文件 读取完剩余内容后关闭
+func (f *FileSource) poll() {
+	for _, t := range f.files {
+		t.seen = false
+	}
+	for _, pattern := range f.conf.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, p := range matches {
+			f.open(p)
+		}
+	}
+	f.first = false
+	// 状态文件中的进度只在启动后第一次扫描时使用
+	// 停止期间被切割的文件 Zabbix 会重命名为 .old 读取完剩余内容
+	for id, s := range f.saved {
+		delete(f.saved, id)
+		if !f.openRotated(id, s) {
+			logger.Warnf("file source %s (%s) no longer exists, drop its state", s.Path, id)
+		}
+	}
+	for id, t := range f.files {
+		if f.ctx.Err() != nil {
+			return
+		}
+		if err := f.read(t); err != nil {
+			logger.Errorf("file source read %s failed: %v", t.Path, err)
+		}
+		if !t.seen {
+			logger.Infof("file source %s rotated or removed, stop following", t.Path)
+			t.file.Close()
+			delete(f.files, id)
+		}
+	}
+}
+
+func (f *FileSource) open(p string) {
+	fi, err := os.Stat(p)
+	if err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+	id, ok := fileID(fi)
+	if !ok {
+		return
+	}
+	if t, ok := f.files[id]; ok {
+		t.seen = true
+		t.Path = p
+		return
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		logger.Errorf("file source open %s failed: %v", p, err)
+		return
+	}
+	t := &tracked{fileState: fileState{Path: p}, file: file, seen: true}
+	if s, ok := f.saved[id]; ok {
+		t.Offset = s.Offset
+		delete(f.saved, id)
+	} else if f.first && f.conf.StartAt == StartEnd {
+		t.Offset = fi.Size()
+	}
+	f.files[id] = t
+	logger.Infof("file source start following %s at offset %d", p, t.Offset)
+}
+
+// openRotated 按保存的路径查找已被切割的文件 inode 一致时继续读取
+func (f *FileSource) openRotated(id string, s fileState) bool {
+	for _, p := range []string{s.Path, s.Path + ".old"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if fid, ok := fileID(fi); !ok || fid != id {
+			continue
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			logger.Errorf("file source open %s failed: %v", p, err)
+			return false
+		}
+		f.files[id] = &tracked{fileState: fileState{Path: p, Offset: s.Offset}, file: file}
+		logger.Infof("file source read rest of rotated file %s from offset %d", p, s.Offset)
+		return true
+	}
+	return false
+}
+
+// read 从上次的位置读取完整的行发送给处理流程
+// 末尾不完整的行留到下次读取
+func (f *FileSource) read(t *tracked) error {
+	fi, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < t.Offset {
+		logger.Warnf("file source %s truncated, read from beginning", t.Path)
+		t.Offset = 0
+		t.skipping = false
+	}
+	size := f.conf.ReadSize
+	buf := make([]byte, size)
+	for t.Offset < fi.Size() {
+		n, err := t.file.ReadAt(buf, t.Offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		chunk := buf[:n]
+		if t.skipping {
+			next := bytes.IndexByte(chunk, '\n')
+			if next < 0 {
+				t.Offset += int64(n)
+				continue
+			}
+			t.Offset += int64(next + 1)
+			t.skipping = false
+			continue
+		}
+		end := bytes.LastIndexByte(chunk, '\n')
+		if end < 0 {
+			if n < len(buf) {
+				// 行尚未写完
+				return nil
+			}
+			if len(buf) >= f.conf.MaxLineSize {
+				// 丢弃已读取的部分 剩余部分在读到换行前都跳过
+				logger.Errorf("file source %s line at offset %d exceeds %d bytes, skipped", t.Path, t.Offset, f.conf.MaxLineSize)
+				t.Offset += int64(n)
+				t.skipping = true
+				continue
+			}
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		data := make([]byte, end+1)
+		copy(data, chunk[:end+1])
+		select {
+		case f.ch <- data:
+			t.Offset += int64(end + 1)
+		case <-f.ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *FileSource) loadState() error {
+	data, err := os.ReadFile(f.conf.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file %s: %v", f.conf.StateFile, err)
+	}
+	if err := json.Unmarshal(data, &f.saved); err != nil {
+		return fmt.Errorf("failed to unmarshal state file %s: %v", f.conf.StateFile, err)
+	}
+	return nil
+}
+
+// saveState 先写入临时文件再重命名 避免进程退出时状态文件损坏
+func (f *FileSource) saveState() error {
+	state := make(map[string]fileState, len(f.files)+len(f.saved))
+	for id, s := range f.saved {
+		state[id] = s
+	}
+	for id, t := range f.files {
+		state[id] = t.fileState
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.conf.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := f.conf.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.conf.StateFile)
+}
+
+func (f *FileSource) saveStateLogged() {
+	if err := f.saveState(); err != nil {
+		logger.Errorf("file source save state failed: %v", err)
+	}
+}
+
+func (f *FileSource) Stop() {
+	f.cancel()
+	f.wg.Wait()
+}
@@ -0,0 +1,220 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/source"
+)
+
+var (
+	defaultListen         = ":8088"
+	defaultPath           = "/"
+	defaultMaxBodySize    = int64(16 << 20)
+	defaultEnqueueTimeout = 100 * time.Millisecond
+	defaultRetryAfter     = 1
+)
+
+func init() {
+	if err := source.RegisterSource("http", NewHTTPSource); err != nil {
+		fmt.Printf("failed to register http source: %v\n", err)
+	}
+}
+
+type HTTPConfig struct {
+	// Listen 监听地址
+	Listen string `mapstructure:"listen"`
+	// Path 接收数据的路径
+	Path string `mapstructure:"path"`
+	// BearerToken 不为空时校验请求的 Authorization 头
+	BearerToken string `mapstructure:"bearer_token"`
+	// MaxBodySize 请求体解压后的最大字节数 超过时返回 413
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+	// EnqueueTimeout 处理流程繁忙时的最长等待时间 超时返回 429
+	EnqueueTimeout time.Duration `mapstructure:"enqueue_timeout"`
+	// RetryAfter 429 响应中建议客户端等待的秒数
+	RetryAfter int    `mapstructure:"retry_after"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+}
+
+// HTTPSource 接收 POST 的 NDJSON 或 JSON 数组格式的 Zabbix 导出记录
+// Zabbix 6.4 之后的 connector 可以直接推送到该接口
+type HTTPSource struct {
+	wg     sync.WaitGroup
+	conf   HTTPConfig
+	server *nethttp.Server
+	ch     chan<- []byte
+}
+
+func NewHTTPSource(conf config.SourceConfig) source.SourceInstance {
+	c := HTTPConfig{}
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode http source config: %v", err)
+		return nil
+	}
+	if c.Listen == "" {
+		c.Listen = defaultListen
+	}
+	if c.Path == "" {
+		c.Path = defaultPath
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaultMaxBodySize
+	}
+	if c.EnqueueTimeout <= 0 {
+		c.EnqueueTimeout = defaultEnqueueTimeout
+	}
+	if c.RetryAfter <= 0 {
+		c.RetryAfter = defaultRetryAfter
+	}
+	return &HTTPSource{
+		wg:   sync.WaitGroup{},
+		conf: c,
+	}
+}
+
+func (h *HTTPSource) Name() string {
+	return "http"
+}
+
+func (h *HTTPSource) Run(ch chan<- []byte) error {
+	h.ch = ch
+	mux := nethttp.NewServeMux()
+	mux.HandleFunc(h.conf.Path, h.handle)
+	h.server = &nethttp.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	listener, err := net.Listen("tcp", h.conf.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", h.conf.Listen, err)
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		var err error
+		if h.conf.CertFile != "" {
+			err = h.server.ServeTLS(listener, h.conf.CertFile, h.conf.KeyFile)
+		} else {
+			err = h.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			logger.Errorf("http source serve failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (h *HTTPSource) authorized(r *nethttp.Request) bool {
+	if h.conf.BearerToken == "" {
+		return true
+	}
+	expected := []byte("Bearer " + h.conf.BearerToken)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) == 1
+}
+
+func (h *HTTPSource) handle(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if r.Method != nethttp.MethodPost {
+		nethttp.Error(w, "method not allowed", nethttp.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		nethttp.Error(w, "unauthorized", nethttp.StatusUnauthorized)
+		return
+	}
+	var body io.Reader = nethttp.MaxBytesReader(w, r.Body, h.conf.MaxBodySize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			nethttp.Error(w, "invalid gzip body", nethttp.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, h.conf.MaxBodySize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var maxErr *nethttp.MaxBytesError
+		if errors.As(err, &maxErr) {
+			nethttp.Error(w, "request body too large", nethttp.StatusRequestEntityTooLarge)
+			return
+		}
+		nethttp.Error(w, "read body failed", nethttp.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > h.conf.MaxBodySize {
+		nethttp.Error(w, "request body too large", nethttp.StatusRequestEntityTooLarge)
+		return
+	}
+	lines, err := toLines(data)
+	if err != nil {
+		nethttp.Error(w, err.Error(), nethttp.StatusBadRequest)
+		return
+	}
+	if len(lines) == 0 {
+		w.WriteHeader(nethttp.StatusOK)
+		return
+	}
+	if !h.enqueue(r.Context(), lines) {
+		w.Header().Set("Retry-After", strconv.Itoa(h.conf.RetryAfter))
+		nethttp.Error(w, "pipeline is busy", nethttp.StatusTooManyRequests)
+		return
+	}
+	w.WriteHeader(nethttp.StatusOK)
+}
+
+// enqueue 在超时时间内将数据交给处理流程 处理流程繁忙时返回 false
+func (h *HTTPSource) enqueue(ctx context.Context, data []byte) bool {
+	timer := time.NewTimer(h.conf.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case h.ch <- data:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// toLines 将 JSON 数组转换为 NDJSON NDJSON 原样返回
+func toLines(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return trimmed, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %v", err)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(trimmed)))
+	for _, item := range items {
+		if err := json.Compact(buf, item); err != nil {
+			return nil, fmt.Errorf("invalid JSON item: %v", err)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *HTTPSource) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.server.Shutdown(ctx); err != nil {
+		logger.Errorf("http source shutdown failed: %v", err)
+	}
+	h.wg.Wait()
+}
@@ -0,0 +1,239 @@
+package trapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/source"
+	"zabbix-source/zbxproto"
+)
+
+var (
+	defaultListen         = ":10051"
+	defaultMaxPacketSize  = int64(64 << 20)
+	defaultTimeout        = 30 * time.Second
+	defaultMaxConnections = 256
+)
+
+func init() {
+	if err := source.RegisterSource("zabbix_trapper", NewTrapperSource); err != nil {
+		fmt.Printf("failed to register zabbix_trapper source: %v\n", err)
+	}
+}
+
+type TrapperConfig struct {
+	// Listen 监听地址
+	Listen string `mapstructure:"listen"`
+	// MaxPacketSize 单个请求解压后的最大字节数
+	MaxPacketSize int64 `mapstructure:"max_packet_size"`
+	// Timeout 单个连接的读写超时
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxConnections 最大并发连接数
+	MaxConnections int `mapstructure:"max_connections"`
+	// CompressResponse 响应是否压缩
+	CompressResponse bool `mapstructure:"compress_response"`
+}
+
+// TrapperSource 监听 TCP 端口 接收 zabbix_sender 协议推送的数据
+// 每个值转换为一条 history 记录 由于没有 itemid 记录只携带主机与 key
+type TrapperSource struct {
+	wg       sync.WaitGroup
+	conf     TrapperConfig
+	listener net.Listener
+	sem      chan struct{}
+	ch       chan<- []byte
+
+	// mu 保护 conns 与 closed Stop 之后接受的连接直接关闭
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func NewTrapperSource(conf config.SourceConfig) source.SourceInstance {
+	c := TrapperConfig{}
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode zabbix_trapper config: %v", err)
+		return nil
+	}
+	if c.Listen == "" {
+		c.Listen = defaultListen
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = defaultMaxPacketSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.MaxConnections <= 0 {
+		c.MaxConnections = defaultMaxConnections
+	}
+	return &TrapperSource{
+		wg:    sync.WaitGroup{},
+		conf:  c,
+		sem:   make(chan struct{}, c.MaxConnections),
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+func (t *TrapperSource) Name() string {
+	return "zabbix_trapper"
+}
+
+func (t *TrapperSource) Run(ch chan<- []byte) error {
+	listener, err := net.Listen("tcp", t.conf.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", t.conf.Listen, err)
+	}
+	t.listener = listener
+	t.ch = ch
+	t.wg.Add(1)
+	go t.accept()
+	return nil
+}
+
+func (t *TrapperSource) accept() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				logger.Infof("zabbix_trapper listener closed")
+				return
+			}
+			logger.Errorf("zabbix_trapper accept failed: %v", err)
+			continue
+		}
+		// 等待空闲连接数时可能已经执行了 Stop
+		t.sem <- struct{}{}
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			conn.Close()
+			<-t.sem
+			return
+		}
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		go t.handle(conn)
+	}
+}
+
+// handle 处理一个连接上的请求 直到对端关闭连接
+func (t *TrapperSource) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		<-t.sem
+		t.wg.Done()
+	}()
+	for {
+		conn.SetDeadline(time.Now().Add(t.conf.Timeout))
+		data, err := zbxproto.Read(conn, t.conf.MaxPacketSize)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				logger.Debugf("zabbix_trapper read from %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		resp := t.process(data)
+		body, err := json.Marshal(resp)
+		if err != nil {
+			logger.Errorf("zabbix_trapper marshal response failed: %v", err)
+			return
+		}
+		if err := zbxproto.Write(conn, body, t.conf.CompressResponse); err != nil {
+			logger.Debugf("zabbix_trapper write to %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// process 将请求中的值转换为 history 记录发送给处理流程
+func (t *TrapperSource) process(data []byte) zbxproto.SenderResponse {
+	start := time.Now()
+	req := zbxproto.SenderRequest{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return zbxproto.SenderResponse{Response: zbxproto.ResponseFailed, Info: "invalid JSON request"}
+	}
+	if req.Request != zbxproto.RequestSenderData && req.Request != "agent data" {
+		return zbxproto.SenderResponse{Response: zbxproto.ResponseFailed, Info: "unsupported request " + req.Request}
+	}
+	result := zbxproto.Result{Total: len(req.Data)}
+	var lines []byte
+	for _, item := range req.Data {
+		line, err := toRecord(item, req.Clock, req.Ns)
+		if err != nil {
+			result.Failed++
+			continue
+		}
+		lines = append(lines, line...)
+		lines = append(lines, '\n')
+		result.Processed++
+	}
+	if len(lines) > 0 {
+		t.ch <- lines
+	}
+	result.Seconds = time.Since(start).Seconds()
+	return zbxproto.SenderResponse{Response: zbxproto.ResponseSuccess, Info: result.Info()}
+}
+
+// toRecord 将 zabbix_sender 的值转换为 Zabbix 实时导出格式的 history 记录
+// 值为整数时视为 uint 类型 浮点数视为 float 类型 其余视为文本
+func toRecord(item zbxproto.SenderItem, clock, ns int64) ([]byte, error) {
+	if item.Host == "" || item.Key == "" {
+		return nil, fmt.Errorf("host and key are required")
+	}
+	if item.Clock != 0 {
+		clock, ns = item.Clock, item.Ns
+	}
+	if clock == 0 {
+		now := time.Now()
+		clock, ns = now.Unix(), int64(now.Nanosecond())
+	}
+	rec := record.Record{
+		Host:    &record.Host{Host: item.Host, Name: item.Host},
+		ItemKey: item.Key,
+		Clock:   clock,
+		Ns:      ns,
+	}
+	value := strings.TrimSpace(item.Value)
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		rec.ValueType = record.ValueTypeUint
+		rec.Value = json.RawMessage(value)
+	} else if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		rec.ValueType = record.ValueTypeFloat
+		rec.SetNumericValue(v)
+	} else {
+		rec.ValueType = record.ValueTypeText
+		raw, err := json.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		rec.Value = raw
+	}
+	return json.Marshal(&rec)
+}
+
+func (t *TrapperSource) Stop() {
+	t.listener.Close()
+	t.mu.Lock()
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+}
@@ -0,0 +1,441 @@
+package zabbixapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/source"
+	"zabbix-source/zbxapi"
+)
+
+var (
+	defaultPollInterval = 30 * time.Second
+	defaultTimeout      = 30 * time.Second
+	defaultBatchSize    = 1000
+)
+
+const (
+	StartBeginning = "beginning"
+	StartEnd       = "end"
+)
+
+func init() {
+	if err := source.RegisterSource("zabbix_api", NewZabbixAPISource); err != nil {
+		fmt.Printf("failed to register zabbix_api source: %v\n", err)
+	}
+}
+
+type ZabbixAPIConfig struct {
+	// URL api_jsonrpc.php 的完整地址 例如 http://zabbix/api_jsonrpc.php
+	URL   string `mapstructure:"url"`
+	Token string `mapstructure:"token"`
+	// LegacyAuth Zabbix 6.4 之前的版本 token 放在请求的 auth 字段中
+	LegacyAuth         bool          `mapstructure:"legacy_auth"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	PollInterval       time.Duration `mapstructure:"poll_interval"`
+	// BatchSize 单次 event.get 的最大事件数
+	BatchSize int `mapstructure:"batch_size"`
+	// StateFile 最后读取的 eventid 以及未恢复问题的保存路径
+	StateFile string `mapstructure:"state_file"`
+	// StartAt 没有读取进度时的起始位置 beginning end
+	StartAt string `mapstructure:"start_at"`
+}
+
+// state 读取进度
+// Open 已发送但尚未恢复的问题 用于为恢复事件查找对应的问题
+type state struct {
+	LastEventID uint64   `json:"last_eventid"`
+	Open        []uint64 `json:"open"`
+}
+
+// event event.get 返回的事件 API 中的数值均以字符串表示
+type event struct {
+	EventID  string        `json:"eventid"`
+	Clock    string        `json:"clock"`
+	Ns       string        `json:"ns"`
+	Value    string        `json:"value"`
+	Name     string        `json:"name"`
+	Severity string        `json:"severity"`
+	Hosts    []record.Host `json:"hosts"`
+	Tags     []record.Tag  `json:"tags"`
+}
+
+type problem struct {
+	EventID  string `json:"eventid"`
+	REventID string `json:"r_eventid"`
+}
+
+// ZabbixAPISource 通过 Zabbix API 轮询触发器事件
+// 用于未开启实时导出的环境 输出的问题与恢复记录与实时导出格式一致
+type ZabbixAPISource struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conf   ZabbixAPIConfig
+	client *zbxapi.Client
+	ch     chan<- []byte
+	last   uint64
+	open   map[uint64]struct{}
+}
+
+func NewZabbixAPISource(conf config.SourceConfig) source.SourceInstance {
+	c := ZabbixAPIConfig{}
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode zabbix_api config: %v", err)
+		return nil
+	}
+	if c.URL == "" {
+		logger.Errorf("zabbix_api url is required")
+		return nil
+	}
+	if c.StateFile == "" {
+		logger.Errorf("zabbix_api state_file is required")
+		return nil
+	}
+	if c.StartAt == "" {
+		c.StartAt = StartEnd
+	}
+	if c.StartAt != StartBeginning && c.StartAt != StartEnd {
+		logger.Errorf("zabbix_api unknown start_at %s", c.StartAt)
+		return nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	httpClient := &http.Client{Timeout: c.Timeout}
+	if c.InsecureSkipVerify {
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return &ZabbixAPISource{
+		wg:     sync.WaitGroup{},
+		conf:   c,
+		client: zbxapi.NewClient(c.URL, c.Token, c.LegacyAuth, httpClient),
+		open:   make(map[uint64]struct{}),
+	}
+}
+
+func (z *ZabbixAPISource) Name() string {
+	return "zabbix_api"
+}
+
+func (z *ZabbixAPISource) Run(ch chan<- []byte) error {
+	z.ctx, z.cancel = context.WithCancel(context.Background())
+	found, err := z.loadState()
+	if err != nil {
+		return err
+	}
+	if !found && z.conf.StartAt == StartEnd {
+		if err := z.seek(); err != nil {
+			return fmt.Errorf("zabbix_api seek to latest event failed: %v", err)
+		}
+	}
+	z.ch = ch
+	z.wg.Add(1)
+	go z.run()
+	return nil
+}
+
+// seek 从最新的事件开始读取 当前未恢复的问题加入 open 以便发送其恢复事件
+func (z *ZabbixAPISource) seek() error {
+	var latest []problem
+	err := z.client.Call(z.ctx, "event.get", map[string]any{
+		"output":    []string{"eventid"},
+		"source":    0,
+		"object":    0,
+		"sortfield": []string{"eventid"},
+		"sortorder": "DESC",
+		"limit":     1,
+	}, &latest)
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		z.last, _ = strconv.ParseUint(latest[0].EventID, 10, 64)
+	}
+	// 未恢复的问题按 eventid 分批读取
+	from := uint64(0)
+	for z.last > 0 {
+		var problems []problem
+		err = z.client.Call(z.ctx, "problem.get", map[string]any{
+			"output":       []string{"eventid"},
+			"source":       0,
+			"object":       0,
+			"eventid_from": strconv.FormatUint(from, 10),
+			"eventid_till": strconv.FormatUint(z.last, 10),
+			"sortfield":    []string{"eventid"},
+			"sortorder":    "ASC",
+			"limit":        z.conf.BatchSize,
+		}, &problems)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			id, _ := strconv.ParseUint(p.EventID, 10, 64)
+			if id != 0 && id <= z.last {
+				z.open[id] = struct{}{}
+			}
+			from = id + 1
+		}
+		if len(problems) < z.conf.BatchSize {
+			break
+		}
+	}
+	logger.Infof("zabbix_api start from eventid %d with %d open problems", z.last, len(z.open))
+	return nil
+}
+
+func (z *ZabbixAPISource) run() {
+	defer z.wg.Done()
+	ticker := time.NewTicker(z.conf.PollInterval)
+	defer ticker.Stop()
+	z.poll()
+	for {
+		select {
+		case <-z.ctx.Done():
+			logger.Infof("zabbix_api source exiting")
+			return
+		case <-ticker.C:
+			z.poll()
+		}
+	}
+}
+
+// poll 分批读取新的事件 直到没有更多事件
+func (z *ZabbixAPISource) poll() {
+	for z.ctx.Err() == nil {
+		n, err := z.pollOnce()
+		if err != nil {
+			if z.ctx.Err() == nil {
+				logger.Errorf("zabbix_api poll events failed: %v", err)
+			}
+			break
+		}
+		if n < z.conf.BatchSize {
+			break
+		}
+	}
+	if err := z.saveState(); err != nil {
+		logger.Errorf("zabbix_api save state failed: %v", err)
+	}
+}
+
+func (z *ZabbixAPISource) pollOnce() (int, error) {
+	var events []event
+	err := z.client.Call(z.ctx, "event.get", map[string]any{
+		"output":       []string{"eventid", "clock", "ns", "value", "name", "severity"},
+		"source":       0,
+		"object":       0,
+		"eventid_from": strconv.FormatUint(z.last+1, 10),
+		"selectHosts":  []string{"host", "name"},
+		"selectTags":   []string{"tag", "value"},
+		"sortfield":    []string{"eventid"},
+		"sortorder":    "ASC",
+		"limit":        z.conf.BatchSize,
+	}, &events)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	recovered := false
+	for _, e := range events {
+		id, _ := strconv.ParseUint(e.EventID, 10, 64)
+		if e.Value == "1" {
+			z.open[id] = struct{}{}
+		} else {
+			recovered = true
+		}
+	}
+	// 恢复事件本身不包含问题的 eventid 通过问题事件的 r_eventid 反查
+	var (
+		recoveryOf map[uint64][]uint64
+		closedBy   map[uint64]uint64
+	)
+	if recovered {
+		if recoveryOf, closedBy, err = z.resolve(); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		lines []byte
+		last  uint64
+	)
+	for _, e := range events {
+		rec := toRecord(e)
+		last = rec.EventID
+		if rec.Value[0] != '0' {
+			if lines, err = appendRecord(lines, rec); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// 一个恢复事件可能同时关闭多个问题 每个问题输出一条恢复记录
+		problems := recoveryOf[rec.EventID]
+		if len(problems) == 0 {
+			logger.Debugf("zabbix_api recovery event %d without known problem", rec.EventID)
+			if lines, err = appendRecord(lines, rec); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		for _, pid := range problems {
+			r := *rec
+			r.PEventID = pid
+			if lines, err = appendRecord(lines, &r); err != nil {
+				return 0, err
+			}
+		}
+	}
+	select {
+	case z.ch <- lines:
+		z.last = last
+	case <-z.ctx.Done():
+		return len(events), nil
+	}
+	// 恢复事件已经读过的问题不再需要跟踪
+	for pid, rid := range closedBy {
+		if rid <= z.last {
+			delete(z.open, pid)
+		}
+	}
+	return len(events), nil
+}
+
+func appendRecord(lines []byte, rec *record.Record) ([]byte, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, line...)
+	return append(lines, '\n'), nil
+}
+
+// resolve 通过 event.get 查询未恢复问题的 r_eventid
+// 返回恢复事件到问题的映射 以及已恢复问题到其恢复事件的映射
+// problem.get 只返回未恢复或最近恢复的问题 event.get 按 eventid 查询不受恢复时间影响
+// event.get 不再返回的问题已被删除 从 open 中移除
+func (z *ZabbixAPISource) resolve() (map[uint64][]uint64, map[uint64]uint64, error) {
+	ids := make([]string, 0, len(z.open))
+	for id := range z.open {
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+	alive := make(map[uint64]struct{}, len(ids))
+	recoveryOf := make(map[uint64][]uint64)
+	closedBy := make(map[uint64]uint64)
+	for start := 0; start < len(ids); start += z.conf.BatchSize {
+		end := min(start+z.conf.BatchSize, len(ids))
+		var problems []problem
+		err := z.client.Call(z.ctx, "event.get", map[string]any{
+			"output":   []string{"eventid", "r_eventid"},
+			"source":   0,
+			"object":   0,
+			"value":    1,
+			"eventids": ids[start:end],
+		}, &problems)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range problems {
+			id, _ := strconv.ParseUint(p.EventID, 10, 64)
+			alive[id] = struct{}{}
+			if rid, _ := strconv.ParseUint(p.REventID, 10, 64); rid != 0 {
+				recoveryOf[rid] = append(recoveryOf[rid], id)
+				closedBy[id] = rid
+			}
+		}
+	}
+	for id := range z.open {
+		if _, ok := alive[id]; !ok {
+			delete(z.open, id)
+		}
+	}
+	for _, pids := range recoveryOf {
+		slices.Sort(pids)
+	}
+	return recoveryOf, closedBy, nil
+}
+
+// toRecord 将事件转换为实时导出格式的问题或恢复记录
+func toRecord(e event) *record.Record {
+	rec := &record.Record{}
+	rec.EventID, _ = strconv.ParseUint(e.EventID, 10, 64)
+	rec.Clock, _ = strconv.ParseInt(e.Clock, 10, 64)
+	rec.Ns, _ = strconv.ParseInt(e.Ns, 10, 64)
+	if e.Value != "1" {
+		rec.Value = json.RawMessage("0")
+		return rec
+	}
+	rec.Value = json.RawMessage("1")
+	rec.Name = e.Name
+	rec.Severity, _ = strconv.Atoi(e.Severity)
+	rec.Hosts = e.Hosts
+	rec.Tags = e.Tags
+	return rec
+}
+
+func (z *ZabbixAPISource) loadState() (bool, error) {
+	data, err := os.ReadFile(z.conf.StateFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read state file %s: %v", z.conf.StateFile, err)
+	}
+	s := state{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return false, fmt.Errorf("failed to unmarshal state file %s: %v", z.conf.StateFile, err)
+	}
+	z.last = s.LastEventID
+	for _, id := range s.Open {
+		z.open[id] = struct{}{}
+	}
+	return true, nil
+}
+
+// saveState 先写入临时文件再重命名 避免进程退出时状态文件损坏
+func (z *ZabbixAPISource) saveState() error {
+	s := state{LastEventID: z.last, Open: make([]uint64, 0, len(z.open))}
+	for id := range z.open {
+		s.Open = append(s.Open, id)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(z.conf.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := z.conf.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, z.conf.StateFile)
+}
+
+func (z *ZabbixAPISource) Stop() {
+	z.cancel()
+	z.wg.Wait()
+	if err := z.saveState(); err != nil {
+		logger.Errorf("zabbix_api save state failed: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package zabbixapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"zabbix-source/config"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+)
+
+type fakeEvent struct {
+	id    uint64
+	rid   uint64
+	value int
+}
+
+// fakeZabbix 在内存中模拟 event.get 与 problem.get 只实现 source 使用到的参数
+type fakeZabbix struct {
+	mu     sync.Mutex
+	events []fakeEvent
+	// froms 每次 event.get 轮询新事件时的 eventid_from
+	froms []string
+}
+
+// add 添加事件 recovers 不为空时为恢复事件 同时设置这些问题的 r_eventid
+func (f *fakeZabbix) add(id uint64, recovers ...uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(recovers) == 0 {
+		f.events = append(f.events, fakeEvent{id: id, value: 1})
+		return
+	}
+	f.events = append(f.events, fakeEvent{id: id})
+	for i := range f.events {
+		if slices.Contains(recovers, f.events[i].id) {
+			f.events[i].rid = id
+		}
+	}
+}
+
+func (f *fakeZabbix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string         `json:"method"`
+		Params map[string]any `json:"params"`
+		ID     int64          `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	result := f.call(req.Method, req.Params)
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": result, "id": req.ID})
+}
+
+func (f *fakeZabbix) call(method string, params map[string]any) []map[string]any {
+	id := func(name string) uint64 {
+		v, _ := params[name].(string)
+		n, _ := strconv.ParseUint(v, 10, 64)
+		return n
+	}
+	from, till := id("eventid_from"), id("eventid_till")
+	var eventids []string
+	if ids, ok := params["eventids"].([]any); ok {
+		for _, v := range ids {
+			eventids = append(eventids, v.(string))
+		}
+	}
+	if method == "event.get" && params["eventid_from"] != nil {
+		f.froms = append(f.froms, params["eventid_from"].(string))
+	}
+	var matched []fakeEvent
+	for _, e := range f.events {
+		switch {
+		case method == "problem.get" && (e.value != 1 || e.rid != 0):
+		case from != 0 && e.id < from:
+		case till != 0 && e.id > till:
+		case eventids != nil && !slices.Contains(eventids, strconv.FormatUint(e.id, 10)):
+		case params["value"] != nil && float64(e.value) != params["value"]:
+		default:
+			matched = append(matched, e)
+		}
+	}
+	if params["sortorder"] == "DESC" {
+		slices.Reverse(matched)
+	}
+	if limit, ok := params["limit"].(float64); ok && int(limit) < len(matched) {
+		matched = matched[:int(limit)]
+	}
+	result := make([]map[string]any, 0, len(matched))
+	for _, e := range matched {
+		result = append(result, map[string]any{
+			"eventid":   strconv.FormatUint(e.id, 10),
+			"r_eventid": strconv.FormatUint(e.rid, 10),
+			"clock":     "1700000000",
+			"ns":        "0",
+			"value":     strconv.Itoa(e.value),
+			"name":      "problem " + strconv.FormatUint(e.id, 10),
+			"severity":  "3",
+			"hosts":     []map[string]string{{"host": "h1", "name": "H1"}},
+			"tags":      []map[string]string{},
+		})
+	}
+	return result
+}
+
+// newTestSource 创建指向 fake 的 source 每批读取 2 个事件
+func newTestSource(t *testing.T, fake *fakeZabbix, stateFile string) *ZabbixAPISource {
+	t.Helper()
+	logger.Init(config.LoggerConfig{OutputPath: t.TempDir()})
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	inst := NewZabbixAPISource(config.SourceConfig{
+		"url":        srv.URL,
+		"state_file": stateFile,
+		"batch_size": 2,
+	})
+	if inst == nil {
+		t.Fatal("failed to create source")
+	}
+	z := inst.(*ZabbixAPISource)
+	z.ctx, z.cancel = context.WithCancel(context.Background())
+	t.Cleanup(z.cancel)
+	return z
+}
+
+// pollRecords 执行一次轮询 返回输出的全部记录
+func pollRecords(t *testing.T, z *ZabbixAPISource) []*record.Record {
+	t.Helper()
+	ch := make(chan []byte, 10)
+	z.ch = ch
+	z.poll()
+	close(ch)
+	var recs []*record.Record
+	for data := range ch {
+		r, errs := record.ParseLines(data)
+		if len(errs) > 0 {
+			t.Fatalf("parse: %v", errs)
+		}
+		recs = append(recs, r...)
+	}
+	return recs
+}
+
+type wantEvent struct {
+	eventID, pEventID uint64
+	problem           bool
+}
+
+func checkRecords(t *testing.T, recs []*record.Record, want []wantEvent) {
+	t.Helper()
+	if len(recs) != len(want) {
+		t.Fatalf("got %d records, want %d", len(recs), len(want))
+	}
+	for i, w := range want {
+		r := recs[i]
+		if r.Type != record.TypeEvents || r.EventID != w.eventID || r.PEventID != w.pEventID || r.IsProblem() != w.problem {
+			t.Errorf("record %d = eventid %d p_eventid %d problem %v, want %+v", i, r.EventID, r.PEventID, r.IsProblem(), w)
+		}
+	}
+}
+
+func TestProblemRecovery(t *testing.T) {
+	fake := &fakeZabbix{}
+
+	// 启动前 1 2 未恢复 3 已被 4 恢复
+	fake.add(1)
+	fake.add(2)
+	fake.add(3)
+	fake.add(4, 3)
+
+	stateFile := filepath.Join(t.TempDir(), "api.state")
+	z := newTestSource(t, fake, stateFile)
+	if err := z.seek(); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if z.last != 4 {
+		t.Fatalf("seek last = %d, want 4", z.last)
+	}
+	if _, ok := z.open[1]; !ok || len(z.open) != 2 {
+		t.Fatalf("seek open = %v, want 1 2", z.open)
+	}
+
+	// 7 恢复启动前的问题 1 8 恢复同一次轮询中前一批的问题 5
+	fake.add(5)
+	fake.add(6)
+	fake.add(7, 1)
+	fake.add(8, 5)
+	recs := pollRecords(t, z)
+	checkRecords(t, recs, []wantEvent{{5, 0, true}, {6, 0, true}, {7, 1, false}, {8, 5, false}})
+	// 每批 2 个事件 第三次请求没有新事件
+	if !slices.Equal(fake.froms, []string{"5", "7", "9"}) {
+		t.Errorf("event.get eventid_from = %v, want [5 7 9]", fake.froms)
+	}
+	if z.last != 8 {
+		t.Errorf("last = %d, want 8", z.last)
+	}
+	if _, ok := z.open[2]; !ok || len(z.open) != 2 {
+		t.Errorf("open = %v, want 2 6", z.open)
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	s := state{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("unmarshal state: %v", err)
+	}
+	slices.Sort(s.Open)
+	if s.LastEventID != 8 || !slices.Equal(s.Open, []uint64{2, 6}) {
+		t.Errorf("state = %+v, want last 8 open [2 6]", s)
+	}
+
+	// 没有新事件时进度保持不变
+	z.ch = make(chan []byte, 1)
+	z.poll()
+	if z.last != 8 || fake.froms[len(fake.froms)-1] != "9" {
+		t.Errorf("idle poll moved last to %d from %v", z.last, fake.froms)
+	}
+}
+
+func TestRecoveryClosesMultipleProblems(t *testing.T) {
+	fake := &fakeZabbix{}
+	z := newTestSource(t, fake, filepath.Join(t.TempDir(), "api.state"))
+	if err := z.seek(); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	// 3 同时关闭 1 2 问题 4 的恢复 6 在下一批中
+	fake.add(1)
+	fake.add(2)
+	fake.add(3, 1, 2)
+	fake.add(4)
+	fake.add(5)
+	fake.add(6, 4)
+	recs := pollRecords(t, z)
+	checkRecords(t, recs, []wantEvent{
+		{1, 0, true}, {2, 0, true},
+		{3, 1, false}, {3, 2, false}, {4, 0, true},
+		{5, 0, true}, {6, 4, false},
+	})
+	if _, ok := z.open[5]; !ok || len(z.open) != 1 {
+		t.Errorf("open = %v, want 5", z.open)
+	}
+}
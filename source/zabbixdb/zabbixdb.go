@@ -0,0 +1,498 @@
+package zabbixdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zabbix-source/config"
+	"zabbix-source/db"
+	"zabbix-source/logger"
+	"zabbix-source/record"
+	"zabbix-source/source"
+)
+
+var (
+	defaultTables       = []string{"history", "history_uint", "history_str", "history_text", "history_log", "trends"}
+	defaultPollInterval = 10 * time.Second
+	defaultBatchSize    = 5000
+	defaultItemBatch    = 500
+	defaultDelay        = 30 * time.Second
+)
+
+const (
+	StartBeginning = "beginning"
+	StartEnd       = "end"
+)
+
+func init() {
+	if err := source.RegisterSource("zabbix_db", NewZabbixDBSource); err != nil {
+		fmt.Printf("failed to register zabbix_db source: %v\n", err)
+	}
+}
+
+type ZabbixDBConfig struct {
+	// Tables 需要轮询的表 默认为全部 history 表以及 trends
+	Tables []string `mapstructure:"tables"`
+	// StateFile 各表读取进度的保存路径
+	StateFile string `mapstructure:"state_file"`
+	// StartAt 没有读取进度时的起始位置 beginning end
+	StartAt      string        `mapstructure:"start_at"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// BatchSize 单次查询的最大行数
+	BatchSize int `mapstructure:"batch_size"`
+	// ItemBatchSize 单次查询的监控项数量
+	// Zabbix 的 history trends 表只有 itemid clock 索引 按监控项分批查询才能使用索引
+	ItemBatchSize int `mapstructure:"item_batch_size"`
+	// Delay 只读取早于当前时间 Delay 的数据
+	// proxy 上报的数据写入时 clock 可能已经落后 晚于 Delay 写入的数据会被跳过
+	Delay time.Duration `mapstructure:"delay"`
+}
+
+// table 轮询的表 以及该表记录在实时导出中的形式
+type table struct {
+	name      string
+	valueType int
+	trends    bool
+	log       bool
+}
+
+var tables = map[string]table{
+	"history":      {name: "history", valueType: record.ValueTypeFloat},
+	"history_uint": {name: "history_uint", valueType: record.ValueTypeUint},
+	"history_str":  {name: "history_str", valueType: record.ValueTypeStr},
+	"history_text": {name: "history_text", valueType: record.ValueTypeText},
+	"history_log":  {name: "history_log", valueType: record.ValueTypeLog, log: true},
+	"trends":       {name: "trends", valueType: record.ValueTypeFloat, trends: true},
+	"trends_uint":  {name: "trends_uint", valueType: record.ValueTypeUint, trends: true},
+}
+
+// mark 单个表的读取进度
+// 每次轮询读取 (From, Until] 时间窗口内的数据 窗口内按 itemid clock ns 顺序分批读取
+// 窗口读取完成后 From 推进到 Until 进程重启时从窗口内最后发送的记录继续
+type mark struct {
+	// From clock 不大于 From 的数据都已发送
+	From int64 `json:"from"`
+	// Until 正在读取的窗口结束时间 0 表示没有未完成的窗口
+	Until int64 `json:"until,omitempty"`
+	// ItemID 窗口内最后发送的记录 Clock 为 0 时表示 itemid 不大于 ItemID 的监控项已读完
+	ItemID uint64 `json:"itemid,omitempty"`
+	Clock  int64  `json:"clock,omitempty"`
+	Ns     int64  `json:"ns,omitempty"`
+}
+
+// ZabbixDBSource 轮询 Zabbix 数据库的 history trends 表
+// 用于没有实时导出功能的 Zabbix 4.x 5.x 输出的记录与实时导出格式一致
+type ZabbixDBSource struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conf   ZabbixDBConfig
+	tables []table
+	db     *db.DB
+	ch     chan<- []byte
+	marks  map[string]mark
+	// noItemTags Zabbix 5.4 之前没有 item_tag 表 查询失败后不再补充监控项标签
+	noItemTags bool
+}
+
+func NewZabbixDBSource(conf config.SourceConfig) source.SourceInstance {
+	c := ZabbixDBConfig{}
+	if err := conf.To(&c); err != nil {
+		logger.Errorf("failed to decode zabbix_db config: %v", err)
+		return nil
+	}
+	if c.StateFile == "" {
+		logger.Errorf("zabbix_db state_file is required")
+		return nil
+	}
+	if len(c.Tables) == 0 {
+		c.Tables = defaultTables
+	}
+	if c.StartAt == "" {
+		c.StartAt = StartEnd
+	}
+	if c.StartAt != StartBeginning && c.StartAt != StartEnd {
+		logger.Errorf("zabbix_db unknown start_at %s", c.StartAt)
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.ItemBatchSize <= 0 {
+		c.ItemBatchSize = defaultItemBatch
+	}
+	if c.Delay <= 0 {
+		c.Delay = defaultDelay
+	}
+	var ts []table
+	for _, name := range c.Tables {
+		t, ok := tables[name]
+		if !ok {
+			logger.Errorf("zabbix_db unsupported table %s", name)
+			return nil
+		}
+		ts = append(ts, t)
+	}
+	return &ZabbixDBSource{
+		wg:     sync.WaitGroup{},
+		conf:   c,
+		tables: ts,
+		marks:  make(map[string]mark),
+	}
+}
+
+func (z *ZabbixDBSource) Name() string {
+	return "zabbix_db"
+}
+
+func (z *ZabbixDBSource) Run(ch chan<- []byte) error {
+	global := config.GetGlobalConfig()
+	if global == nil {
+		return fmt.Errorf("zabbix_db requires zabbix_config")
+	}
+	if err := z.loadState(); err != nil {
+		return err
+	}
+	conn, err := db.Open(global.ZabbixConfig.SQLConfig)
+	if err != nil {
+		return err
+	}
+	z.db = conn
+	z.ch = ch
+	z.ctx, z.cancel = context.WithCancel(context.Background())
+	z.wg.Add(1)
+	go z.run()
+	return nil
+}
+
+func (z *ZabbixDBSource) run() {
+	defer z.wg.Done()
+	ticker := time.NewTicker(z.conf.PollInterval)
+	defer ticker.Stop()
+	z.poll()
+	for {
+		select {
+		case <-z.ctx.Done():
+			logger.Infof("zabbix_db source exiting")
+			return
+		case <-ticker.C:
+			z.poll()
+		}
+	}
+}
+
+func (z *ZabbixDBSource) poll() {
+	now := time.Now().Add(-z.conf.Delay).Unix()
+	for _, t := range z.tables {
+		if z.ctx.Err() != nil {
+			break
+		}
+		// trends 在整点结束后才写入完整的数据
+		until := now
+		if t.trends {
+			until -= 3600
+		}
+		if _, ok := z.marks[t.name]; !ok && z.conf.StartAt == StartEnd {
+			z.marks[t.name] = mark{From: until}
+		}
+		if err := z.pollTable(t, until); err != nil && z.ctx.Err() == nil {
+			logger.Errorf("zabbix_db poll %s failed: %v", t.name, err)
+		}
+	}
+	if err := z.saveState(); err != nil {
+		logger.Errorf("zabbix_db save state failed: %v", err)
+	}
+}
+
+// pollTable 按监控项分批读取窗口内的数据 直到窗口读取完成
+func (z *ZabbixDBSource) pollTable(t table, until int64) error {
+	m := z.marks[t.name]
+	if m.Until == 0 {
+		if until <= m.From {
+			return nil
+		}
+		m = mark{From: m.From, Until: until}
+		z.marks[t.name] = m
+	}
+	for z.ctx.Err() == nil {
+		ids, err := z.items(t, m)
+		if err != nil {
+			return err
+		}
+		lines, last, n, err := z.query(t, m, ids)
+		if err != nil {
+			return err
+		}
+		switch {
+		case n == z.conf.BatchSize:
+			m = last
+		case len(ids) < z.conf.ItemBatchSize:
+			// 最后一批监控项已读完
+			m = mark{From: m.Until}
+		default:
+			m = mark{From: m.From, Until: m.Until, ItemID: ids[len(ids)-1]}
+		}
+		if n > 0 {
+			select {
+			case z.ch <- lines:
+			case <-z.ctx.Done():
+				return nil
+			}
+		}
+		z.marks[t.name] = m
+		if m.Until == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// items 返回进度之后的一批监控项 模板上的监控项没有数据 不参与查询
+func (z *ZabbixDBSource) items(t table, m mark) ([]uint64, error) {
+	op := ">"
+	if m.Clock != 0 {
+		op = ">="
+	}
+	q := fmt.Sprintf(`SELECT i.itemid FROM items i JOIN hosts h ON h.hostid = i.hostid
+WHERE i.value_type = ? AND h.status <> 3 AND i.itemid %s ?
+ORDER BY i.itemid LIMIT ?`, op)
+	rows, err := z.db.QueryContext(z.ctx, q, t.valueType, m.ItemID, z.conf.ItemBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// inClause 返回 IN 查询的占位符与参数
+func inClause(ids []uint64) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+func (z *ZabbixDBSource) query(t table, m mark, ids []uint64) ([]byte, mark, int, error) {
+	if len(ids) == 0 {
+		return nil, m, 0, nil
+	}
+	in, args := inClause(ids)
+	var q string
+	if t.trends {
+		q = fmt.Sprintf(`SELECT t.itemid, t.clock, t.num, t.value_min, t.value_avg, t.value_max, i.name, i.key_, h.host, h.name
+FROM %s t JOIN items i ON i.itemid = t.itemid JOIN hosts h ON h.hostid = i.hostid
+WHERE t.itemid IN (%s) AND t.clock > ? AND t.clock <= ? AND (t.itemid > ? OR (t.itemid = ? AND t.clock > ?))
+ORDER BY t.itemid, t.clock LIMIT ?`, t.name, in)
+		args = append(args, m.From, m.Until, m.ItemID, m.ItemID, m.Clock, z.conf.BatchSize)
+	} else {
+		extra := ""
+		if t.log {
+			extra = ", t.timestamp, t.source, t.severity"
+		}
+		q = fmt.Sprintf(`SELECT t.itemid, t.clock, t.ns, t.value, i.name, i.key_, h.host, h.name%s
+FROM %s t JOIN items i ON i.itemid = t.itemid JOIN hosts h ON h.hostid = i.hostid
+WHERE t.itemid IN (%s) AND t.clock > ? AND t.clock <= ?
+AND (t.itemid > ? OR (t.itemid = ? AND (t.clock > ? OR (t.clock = ? AND t.ns > ?))))
+ORDER BY t.itemid, t.clock, t.ns LIMIT ?`, extra, t.name, in)
+		args = append(args, m.From, m.Until, m.ItemID, m.ItemID, m.Clock, m.Clock, m.Ns, z.conf.BatchSize)
+	}
+	rows, err := z.db.QueryContext(z.ctx, q, args...)
+	if err != nil {
+		return nil, m, 0, err
+	}
+	defer rows.Close()
+	var recs []*record.Record
+	for rows.Next() {
+		rec, err := scan(rows, t)
+		if err != nil {
+			return nil, m, 0, err
+		}
+		recs = append(recs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, m, 0, err
+	}
+	if len(recs) == 0 {
+		return nil, m, 0, nil
+	}
+	if err := z.fillMeta(recs); err != nil {
+		return nil, m, 0, err
+	}
+	var lines []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return nil, m, 0, err
+		}
+		lines = append(lines, line...)
+		lines = append(lines, '\n')
+	}
+	last := recs[len(recs)-1]
+	m = mark{From: m.From, Until: m.Until, ItemID: last.ItemID, Clock: last.Clock, Ns: last.Ns}
+	return lines, m, len(recs), nil
+}
+
+// fillMeta 补充主机组与监控项标签 与实时导出的记录保持一致
+func (z *ZabbixDBSource) fillMeta(recs []*record.Record) error {
+	byItem := make(map[uint64][]*record.Record)
+	var ids []uint64
+	for _, rec := range recs {
+		if _, ok := byItem[rec.ItemID]; !ok {
+			ids = append(ids, rec.ItemID)
+		}
+		byItem[rec.ItemID] = append(byItem[rec.ItemID], rec)
+	}
+	in, args := inClause(ids)
+	groups := make(map[uint64][]string)
+	err := z.queryPairs(fmt.Sprintf(`SELECT i.itemid, g.name, '' FROM items i
+JOIN hosts_groups hg ON hg.hostid = i.hostid JOIN hstgrp g ON g.groupid = hg.groupid
+WHERE i.itemid IN (%s) ORDER BY g.name`, in), args, func(id uint64, name, _ string) {
+		groups[id] = append(groups[id], name)
+	})
+	if err != nil {
+		return fmt.Errorf("query groups failed: %w", err)
+	}
+	tags := make(map[uint64][]record.Tag)
+	if !z.noItemTags {
+		err := z.queryPairs(fmt.Sprintf(`SELECT itemid, tag, value FROM item_tag
+WHERE itemid IN (%s) ORDER BY itemtagid`, in), args, func(id uint64, tag, value string) {
+			tags[id] = append(tags[id], record.Tag{Tag: tag, Value: value})
+		})
+		if err != nil && z.ctx.Err() == nil {
+			logger.Warnf("zabbix_db query item_tag failed, item tags are disabled: %v", err)
+			z.noItemTags = true
+		}
+	}
+	for id, list := range byItem {
+		for _, rec := range list {
+			rec.Groups = groups[id]
+			rec.ItemTags = tags[id]
+		}
+	}
+	return nil
+}
+
+// queryPairs 执行返回 itemid 与两个字符串列的查询
+func (z *ZabbixDBSource) queryPairs(q string, args []any, fn func(id uint64, a, b string)) error {
+	rows, err := z.db.QueryContext(z.ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   uint64
+			a, b string
+		)
+		if err := rows.Scan(&id, &a, &b); err != nil {
+			return err
+		}
+		fn(id, a, b)
+	}
+	return rows.Err()
+}
+
+// scan 将一行数据转换为实时导出格式的记录
+func scan(rows *sql.Rows, t table) (*record.Record, error) {
+	rec := &record.Record{Host: &record.Host{}, ValueType: t.valueType}
+	if t.trends {
+		if err := rows.Scan(&rec.ItemID, &rec.Clock, &rec.Count, &rec.Min, &rec.Avg, &rec.Max,
+			&rec.Name, &rec.ItemKey, &rec.Host.Host, &rec.Host.Name); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+	var (
+		float    float64
+		unsigned uint64
+		text     string
+		value    any
+	)
+	switch t.valueType {
+	case record.ValueTypeFloat:
+		value = &float
+	case record.ValueTypeUint:
+		value = &unsigned
+	default:
+		value = &text
+	}
+	dest := []any{&rec.ItemID, &rec.Clock, &rec.Ns, value, &rec.Name, &rec.ItemKey, &rec.Host.Host, &rec.Host.Name}
+	if t.log {
+		dest = append(dest, &rec.Timestamp, &rec.Source, &rec.Severity)
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	switch t.valueType {
+	case record.ValueTypeFloat:
+		rec.SetNumericValue(float)
+	case record.ValueTypeUint:
+		rec.Value = json.RawMessage(strconv.FormatUint(unsigned, 10))
+	default:
+		raw, err := json.Marshal(text)
+		if err != nil {
+			return nil, err
+		}
+		rec.Value = raw
+	}
+	return rec, nil
+}
+
+func (z *ZabbixDBSource) loadState() error {
+	data, err := os.ReadFile(z.conf.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file %s: %v", z.conf.StateFile, err)
+	}
+	if err := json.Unmarshal(data, &z.marks); err != nil {
+		return fmt.Errorf("failed to unmarshal state file %s: %v", z.conf.StateFile, err)
+	}
+	return nil
+}
+
+// saveState 先写入临时文件再重命名 避免进程退出时状态文件损坏
+func (z *ZabbixDBSource) saveState() error {
+	data, err := json.Marshal(z.marks)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(z.conf.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := z.conf.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, z.conf.StateFile)
+}
+
+func (z *ZabbixDBSource) Stop() {
+	z.cancel()
+	z.wg.Wait()
+	if err := z.saveState(); err != nil {
+		logger.Errorf("zabbix_db save state failed: %v", err)
+	}
+	z.db.Close()
+}
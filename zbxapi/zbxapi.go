@@ -0,0 +1,113 @@
+package zbxapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+var maxResponseSize = int64(64 << 20)
+
+// Error Zabbix API 返回的错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("zabbix api error %d: %s %s", e.Code, e.Message, e.Data)
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+	Auth    string `json:"auth,omitempty"`
+	ID      int64  `json:"id"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+	ID     int64           `json:"id"`
+}
+
+// Client Zabbix JSON-RPC API 客户端 使用 API token 认证
+// Zabbix 6.4 之后 token 通过 Authorization 头传递
+// 更早的版本需要开启 LegacyAuth 将 token 放在请求的 auth 字段中
+type Client struct {
+	url        string
+	token      string
+	legacyAuth bool
+	client     *http.Client
+	id         atomic.Int64
+}
+
+// NewClient url 为 api_jsonrpc.php 的完整地址
+func NewClient(url, token string, legacyAuth bool, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:        url,
+		token:      token,
+		legacyAuth: legacyAuth,
+		client:     client,
+	}
+}
+
+// Call 调用 API 方法 并将 result 解析到 out 中
+func (c *Client) Call(ctx context.Context, method string, params any, out any) error {
+	req := request{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      c.id.Add(1),
+	}
+	if c.legacyAuth {
+		req.Auth = c.token
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal %s request failed: %w", method, err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json-rpc")
+	if !c.legacyAuth && c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("call %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("read %s response failed: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("call %s failed: http status %d", method, resp.StatusCode)
+	}
+	r := response{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("unmarshal %s response failed: %w", method, err)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return fmt.Errorf("unmarshal %s result failed: %w", method, err)
+	}
+	return nil
+}
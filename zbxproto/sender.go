@@ -0,0 +1,58 @@
+package zbxproto
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	RequestSenderData = "sender data"
+	ResponseSuccess   = "success"
+	ResponseFailed    = "failed"
+)
+
+// SenderItem zabbix_sender 协议中的单个值
+type SenderItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock,omitempty"`
+	Ns    int64  `json:"ns,omitempty"`
+}
+
+// SenderRequest zabbix_sender 协议请求
+type SenderRequest struct {
+	Request string       `json:"request"`
+	Data    []SenderItem `json:"data"`
+	Clock   int64        `json:"clock,omitempty"`
+	Ns      int64        `json:"ns,omitempty"`
+}
+
+// SenderResponse zabbix_sender 协议响应
+type SenderResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// Result 响应 info 中的处理结果
+type Result struct {
+	Processed int
+	Failed    int
+	Total     int
+	Seconds   float64
+}
+
+// Info 生成响应的 info 字段
+func (r Result) Info() string {
+	return fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: %f", r.Processed, r.Failed, r.Total, r.Seconds)
+}
+
+// ParseInfo 解析响应的 info 字段
+func ParseInfo(info string) (Result, error) {
+	r := Result{}
+	_, err := fmt.Sscanf(strings.TrimSpace(info), "processed: %d; failed: %d; total: %d; seconds spent: %f", &r.Processed, &r.Failed, &r.Total, &r.Seconds)
+	if err != nil {
+		return r, fmt.Errorf("parse response info %q failed: %w", info, err)
+	}
+	return r, nil
+}
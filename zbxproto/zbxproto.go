@@ -0,0 +1,123 @@
+package zbxproto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Zabbix 通信协议
+// <ZBXD><FLAGS><DATALEN><RESERVED><DATA>
+// FLAGS 0x01 协议标识 0x02 数据经过 zlib 压缩 0x04 大包 长度字段为 8 字节
+// 压缩时 RESERVED 为解压后的长度 否则为 0
+
+const (
+	FlagProtocol   = 0x01
+	FlagCompressed = 0x02
+	FlagLarge      = 0x04
+)
+
+var (
+	header = []byte("ZBXD")
+	// 普通包长度字段只有 4 字节 超过该大小时使用大包
+	maxSmallSize = int64(1<<32 - 1)
+)
+
+// Write 写入一个数据包
+func Write(w io.Writer, data []byte, compress bool) error {
+	flags := byte(FlagProtocol)
+	payload := data
+	reserved := int64(0)
+	if compress {
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		flags |= FlagCompressed
+		payload = buf.Bytes()
+		reserved = int64(len(data))
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(payload)+21))
+	buf.Write(header)
+	if int64(len(payload)) > maxSmallSize || reserved > maxSmallSize {
+		flags |= FlagLarge
+		buf.WriteByte(flags)
+		binary.Write(buf, binary.LittleEndian, uint64(len(payload)))
+		binary.Write(buf, binary.LittleEndian, uint64(reserved))
+	} else {
+		buf.WriteByte(flags)
+		binary.Write(buf, binary.LittleEndian, uint32(len(payload)))
+		binary.Write(buf, binary.LittleEndian, uint32(reserved))
+	}
+	buf.Write(payload)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Read 读取一个数据包并返回解压后的数据
+// maxSize 限制数据的最大字节数 小于等于 0 时不限制
+func Read(r io.Reader, maxSize int64) ([]byte, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:4], header) {
+		return nil, fmt.Errorf("invalid zabbix protocol header %q", head[:4])
+	}
+	flags := head[4]
+	if flags&FlagProtocol == 0 {
+		return nil, fmt.Errorf("unsupported zabbix protocol flags 0x%02x", flags)
+	}
+	var dataLen, reserved int64
+	if flags&FlagLarge != 0 {
+		var l, rs uint64
+		if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &rs); err != nil {
+			return nil, err
+		}
+		dataLen, reserved = int64(l), int64(rs)
+	} else {
+		var l, rs uint32
+		if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &rs); err != nil {
+			return nil, err
+		}
+		dataLen, reserved = int64(l), int64(rs)
+	}
+	if dataLen < 0 || (maxSize > 0 && dataLen > maxSize) {
+		return nil, fmt.Errorf("packet size %d exceeds limit %d", dataLen, maxSize)
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if flags&FlagCompressed == 0 {
+		return data, nil
+	}
+	if reserved < 0 || (maxSize > 0 && reserved > maxSize) {
+		return nil, fmt.Errorf("uncompressed size %d exceeds limit %d", reserved, maxSize)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed data: %w", err)
+	}
+	defer zr.Close()
+	out := bytes.NewBuffer(make([]byte, 0, reserved))
+	if _, err := io.Copy(out, io.LimitReader(zr, reserved+1)); err != nil {
+		return nil, fmt.Errorf("decompress data failed: %w", err)
+	}
+	if int64(out.Len()) != reserved {
+		return nil, fmt.Errorf("uncompressed size mismatch: expect %d, got %d", reserved, out.Len())
+	}
+	return out.Bytes(), nil
+}
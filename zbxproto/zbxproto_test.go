@@ -0,0 +1,156 @@
+package zbxproto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// packet 按协议手工组装数据包 large 时长度字段为 8 字节
+func packet(flags byte, payload []byte, reserved int, large bool) []byte {
+	b := append([]byte("ZBXD"), flags)
+	if large {
+		b = binary.LittleEndian.AppendUint64(b, uint64(len(payload)))
+		b = binary.LittleEndian.AppendUint64(b, uint64(reserved))
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(reserved))
+	}
+	return append(b, payload...)
+}
+
+func zlibData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteHeader(t *testing.T) {
+	data := []byte(`{"request":"sender data"}`)
+	buf := &bytes.Buffer{}
+	if err := Write(buf, data, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := packet(FlagProtocol, data, 0, false); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Write = % x\nwant % x", buf.Bytes(), want)
+	}
+
+	buf.Reset()
+	if err := Write(buf, data, true); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) < 13 || string(b[:4]) != "ZBXD" || b[4] != FlagProtocol|FlagCompressed {
+		t.Fatalf("compressed header = % x", b[:min(len(b), 13)])
+	}
+	if l := binary.LittleEndian.Uint32(b[5:9]); int(l) != len(b)-13 {
+		t.Errorf("compressed data length %d, payload %d", l, len(b)-13)
+	}
+	if r := binary.LittleEndian.Uint32(b[9:13]); int(r) != len(data) {
+		t.Errorf("reserved %d, want uncompressed length %d", r, len(data))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		{},
+		[]byte(`{"response":"success","info":"processed: 1; failed: 0; total: 1; seconds spent: 0.000055"}`),
+		bytes.Repeat([]byte("zabbix "), 10000),
+	}
+	for _, compress := range []bool{false, true} {
+		for _, data := range payloads {
+			buf := &bytes.Buffer{}
+			if err := Write(buf, data, compress); err != nil {
+				t.Fatalf("compress %v: Write: %v", compress, err)
+			}
+			// 连续写入两个包 Read 只读取一个
+			Write(buf, []byte("next"), compress)
+			got, err := Read(buf, 0)
+			if err != nil {
+				t.Fatalf("compress %v len %d: Read: %v", compress, len(data), err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("compress %v: Read returned %d bytes, want %d", compress, len(got), len(data))
+			}
+			if next, err := Read(buf, 0); err != nil || string(next) != "next" {
+				t.Errorf("compress %v: second packet = %q %v", compress, next, err)
+			}
+		}
+	}
+}
+
+func TestReadLarge(t *testing.T) {
+	data := []byte("large packet")
+	got, err := Read(bytes.NewReader(packet(FlagProtocol|FlagLarge, data, 0, true)), 0)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read large = %q %v", got, err)
+	}
+	compressed := zlibData(t, data)
+	got, err = Read(bytes.NewReader(packet(FlagProtocol|FlagLarge|FlagCompressed, compressed, len(data), true)), 0)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read large compressed = %q %v", got, err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	data := []byte("hello zabbix")
+	compressed := zlibData(t, data)
+	// 压缩率高的数据 压缩后小于限制而解压后超过限制
+	bomb := bytes.Repeat([]byte("a"), 4096)
+	bombCompressed := zlibData(t, bomb)
+	tests := []struct {
+		name    string
+		packet  []byte
+		maxSize int64
+		err     string
+	}{
+		{name: "bad header", packet: append([]byte("HTTP/"), make([]byte, 8)...), err: "invalid zabbix protocol header"},
+		{name: "missing protocol flag", packet: packet(FlagCompressed, compressed, len(data), false), err: "unsupported zabbix protocol flags"},
+		{name: "data exceeds limit", packet: packet(FlagProtocol, data, 0, false), maxSize: 4, err: "exceeds limit"},
+		{name: "uncompressed size exceeds limit", packet: packet(FlagProtocol|FlagCompressed, bombCompressed, len(bomb), false), maxSize: 1024, err: "uncompressed size"},
+		{name: "reserved too small", packet: packet(FlagProtocol|FlagCompressed, compressed, len(data)-1, false), err: "size mismatch"},
+		{name: "reserved too large", packet: packet(FlagProtocol|FlagCompressed, compressed, len(data)+1, false), err: "size mismatch"},
+		{name: "not zlib", packet: packet(FlagProtocol|FlagCompressed, data, len(data), false), err: "invalid compressed data"},
+	}
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.packet), tt.maxSize)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Read error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// 数据不完整
+	full := packet(FlagProtocol, data, 0, false)
+	for _, n := range []int{0, 3, 8, len(full) - 1} {
+		if _, err := Read(bytes.NewReader(full[:n]), 0); err == nil {
+			t.Errorf("Read of %d of %d bytes succeeded", n, len(full))
+		} else if n == 0 && err != io.EOF {
+			t.Errorf("Read of empty input error = %v, want EOF", err)
+		}
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	want := Result{Processed: 3, Failed: 1, Total: 4, Seconds: 0.5}
+	got, err := ParseInfo(" " + want.Info() + "\n")
+	if err != nil || got != want {
+		t.Errorf("ParseInfo(Info()) = %+v %v, want %+v", got, err, want)
+	}
+	got, err = ParseInfo("processed: 0; failed: 2; total: 2; seconds spent: 0.000031")
+	if err != nil || got.Failed != 2 || got.Total != 2 {
+		t.Errorf("ParseInfo = %+v %v", got, err)
+	}
+	if _, err := ParseInfo("Invalid request"); err == nil {
+		t.Error("ParseInfo of invalid info succeeded")
+	}
+}